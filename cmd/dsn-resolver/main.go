@@ -1,5 +1,6 @@
 // Package main provides a command-line DNS resolver tool that performs DNS lookups
-// for various record types including A, AAAA, CNAME, MX, TXT, and NS records.
+// for various record types including A, AAAA, CNAME, MX, TXT, NS, SOA, PTR, SRV,
+// SVCB, and HTTPS records.
 //
 // The tool mimics the output format of dig(1) and other standard DNS utilities,
 // providing detailed information about DNS responses including headers, flags,
@@ -8,7 +9,8 @@
 //
 // Usage:
 //
-//	dsn-resolver <domain> [record_type]
+//	dsn-resolver [-edns] <domain> [record_type]
+//	dsn-resolver [-edns] -x <address>
 //
 // Examples:
 //
@@ -16,73 +18,142 @@
 //	dsn-resolver google.com AAAA     # Query IPv6 addresses
 //	dsn-resolver google.com MX       # Query mail exchange records
 //	dsn-resolver google.com TXT      # Query text records
+//	dsn-resolver google.com SOA      # Query the zone's start of authority
+//	dsn-resolver _sip._tcp.example.com SRV # Query service location records
+//	dsn-resolver cloudflare.com HTTPS # Query ALPN, ECH and address hints
+//	dsn-resolver -x 8.8.8.8          # Reverse lookup of an IPv4 or IPv6 address
+//	dsn-resolver -edns example.com   # Send an EDNS(0) OPT record and show the OPT pseudosection
+//
+// Queries are plain RFC 1035 messages unless -edns is given, in which case they
+// advertise a UDP payload size of dns.DefaultEDNSUDPSize and any Extended DNS
+// Errors in the response are printed.
 package main
 
 import (
+	"errors"
 	"fmt"
 	"go-dns-resolver/dns"
+	"net/netip"
 	"os"
+	"slices"
 	"strings"
 )
 
 // main is the entry point of the DNS resolver command-line tool.
 // It parses command-line arguments, validates the record type, performs the DNS
 // resolution using the dns package, and formats the output in a dig-like format.
-// The program exits with status code 1 on any error condition.
+// The program exits with status code 1 on any error condition; DNS error responses
+// such as NXDOMAIN are printed like any other response, as dig(1) does.
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <domain> [record_type]\n", os.Args[0])
+	opts, err := parseArgs(os.Args[1:])
+	if errors.Is(err, errUsage) {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-edns] <domain> [record_type]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [-edns] -x <address>\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Example: %s google.com A\n", os.Args[0])
 		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	domain := os.Args[1]
+	// Use the library to resolve the domain
+	resolver := dns.NewResolver("8.8.8.8:53")
+	if opts.edns {
+		resolver.EDNS = &dns.EDNS{UDPSize: dns.DefaultEDNSUDPSize}
+	}
+	response, err := resolver.Resolve(opts.domain, opts.recordType)
+	var respErr *dns.ResponseError
+	if errors.As(err, &respErr) {
+		// Negative answers such as NXDOMAIN still carry a complete response
+		// (typically with the zone's SOA record), which is worth printing.
+		response = respErr.Message
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	printResponse(response)
+}
+
+// errUsage is returned by parseArgs when the arguments do not name a query.
+var errUsage = errors.New("usage")
+
+// options holds the query described by the command-line arguments.
+type options struct {
+	domain     string
+	recordType dns.RecordType
+	edns       bool // edns sends an EDNS(0) OPT record with the query
+}
+
+// parseArgs interprets the command-line arguments, without the program name, and
+// returns the query to send. The record type defaults to A. Like dig -x, the
+// reverse mode "-x <address>" queries the PTR records of the address's
+// in-addr.arpa or ip6.arpa name. A leading "-edns" turns on EDNS(0), which is
+// off by default.
+func parseArgs(args []string) (options, error) {
+	var opts options
+	if len(args) > 0 && args[0] == "-edns" {
+		opts.edns = true
+		args = args[1:]
+	}
+	if len(args) == 0 || args[0] == "-x" && len(args) < 2 {
+		return options{}, errUsage
+	}
+
+	opts.domain = args[0]
 	recordTypeStr := "A"
-	if len(os.Args) > 2 {
-		recordTypeStr = strings.ToUpper(os.Args[2])
+	if len(args) > 1 {
+		recordTypeStr = strings.ToUpper(args[1])
+	}
+
+	if args[0] == "-x" {
+		addr, err := netip.ParseAddr(args[1])
+		if err != nil {
+			return options{}, fmt.Errorf("invalid IP address '%s'", args[1])
+		}
+		opts.domain, err = dns.ReverseName(addr)
+		if err != nil {
+			return options{}, err
+		}
+		recordTypeStr = "PTR"
 	}
 
-	var recordType dns.RecordType
 	switch recordTypeStr {
 	case "A":
-		recordType = dns.TypeA
+		opts.recordType = dns.TypeA
 	case "AAAA":
-		recordType = dns.TypeAAAA
+		opts.recordType = dns.TypeAAAA
 	case "CNAME":
-		recordType = dns.TypeCNAME
+		opts.recordType = dns.TypeCNAME
 	case "MX":
-		recordType = dns.TypeMX
+		opts.recordType = dns.TypeMX
 	case "TXT":
-		recordType = dns.TypeTXT
+		opts.recordType = dns.TypeTXT
 	case "NS":
-		recordType = dns.TypeNS
+		opts.recordType = dns.TypeNS
+	case "SOA":
+		opts.recordType = dns.TypeSOA
+	case "PTR":
+		opts.recordType = dns.TypePTR
+	case "SRV":
+		opts.recordType = dns.TypeSRV
+	case "SVCB":
+		opts.recordType = dns.TypeSVCB
+	case "HTTPS":
+		opts.recordType = dns.TypeHTTPS
 	default:
-		fmt.Fprintf(os.Stderr, "Error: Unsupported record type '%s'\n", recordTypeStr)
-		os.Exit(1)
-	}
-
-	// Use the library to resolve the domain
-	resolver := dns.NewResolver("8.8.8.8:53")
-	response, err := resolver.Resolve(domain, recordType)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return options{}, fmt.Errorf("unsupported record type '%s'", recordTypeStr)
 	}
-
-	printResponse(response)
+	return opts, nil
 }
 
 // printResponse formats and displays a DNS response message in a dig-like output format.
 // It prints the DNS header information including status codes and flags, followed by
-// the question section and answer section if present. The output format closely
-// mimics the standard dig(1) command-line tool to provide familiar output for
-// network administrators and developers.
-//
-// The function handles DNS message compression limitations by using an empty
-// byte slice for RData string parsing, which works correctly for most common
-// record types that don't rely on cross-record compression references.
+// the question section and the answer, authority and additional sections if present.
+// The output format closely mimics the standard dig(1) command-line tool to provide
+// familiar output for network administrators and developers.
 func printResponse(msg *dns.DNSMessage) {
-	fmt.Printf(";; ->>HEADER<<- opcode: QUERY, status: %s, id: %d\n", getStatus(msg.Header.Flags), msg.Header.ID)
+	fmt.Printf(";; ->>HEADER<<- opcode: QUERY, status: %s, id: %d\n", msg.Rcode(), msg.Header.ID)
 	fmt.Printf(";; flags: %s; QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n\n",
 		getFlags(msg.Header.Flags),
 		msg.Header.QDCOUNT,
@@ -90,6 +161,10 @@ func printResponse(msg *dns.DNSMessage) {
 		msg.Header.NSCOUNT,
 		msg.Header.ARCOUNT)
 
+	if edns := msg.EDNS(); edns != nil {
+		printEDNS(edns)
+	}
+
 	if len(msg.Questions) > 0 {
 		fmt.Println(";; QUESTION SECTION:")
 		for _, q := range msg.Questions {
@@ -98,38 +173,44 @@ func printResponse(msg *dns.DNSMessage) {
 		fmt.Println()
 	}
 
-	// We need the original raw message to correctly parse compressed RData strings
-	// This is a limitation of the current design. A better design would pass the raw
-	// message bytes along with the parsed structure. For now, we accept this limitation.
-	// To fully fix this, the Resolve method would need to return the raw byte slice too.
-	// For this example, we'll assume most simple records don't rely on cross-record compression.
-	rawBytes := []byte{} // This is a placeholder.
+	printSection("ANSWER", msg.Answers)
+	printSection("AUTHORITY", msg.Authority)
+	printSection("ADDITIONAL", msg.Additional)
+}
 
-	if len(msg.Answers) > 0 {
-		fmt.Println(";; ANSWER SECTION:")
-		for _, a := range msg.Answers {
-			fmt.Printf("%s.\t%d\tIN\t%s\t%s\n", a.Name, a.TTL, a.Type, a.RDataString(rawBytes))
-		}
-		fmt.Println()
+// printEDNS prints the OPT pseudo-section of a response in the same form as dig(1),
+// reporting the EDNS version, flags and the UDP payload size advertised by the server,
+// followed by one "; EDE:" line for each Extended DNS Error attached to the response.
+func printEDNS(edns *dns.EDNS) {
+	flags := ""
+	if edns.DO() {
+		flags = " do"
+	}
+	fmt.Println(";; OPT PSEUDOSECTION:")
+	fmt.Printf("; EDNS: version: %d, flags:%s; udp: %d\n", edns.Version, flags, edns.UDPSize)
+	for _, ede := range edns.ExtendedErrors() {
+		fmt.Printf("; EDE: %s\n", ede)
 	}
+	fmt.Println()
 }
 
-// getStatus extracts and returns the human-readable status code from DNS response flags.
-// It examines the RCODE (Response Code) field in the DNS header flags to determine
-// whether the query was successful, resulted in a domain not found error, or
-// encountered another type of error. The function follows RFC 1035 definitions
-// for standard DNS response codes.
-//
-// Returns "NOERROR" for successful queries (RCODE 0), "NXDOMAIN" for non-existent
-// domains (RCODE 3), or "ERROR" for all other error conditions.
-func getStatus(flags uint16) string {
-	if flags&0x000F == 0 {
-		return "NOERROR"
+// printSection prints the resource records of one message section under a
+// dig-style heading. The OPT pseudo-record is skipped because it is shown by
+// printEDNS, and sections left without records are omitted entirely. Record data
+// is rendered from its parsed form, in which compressed names are already
+// expanded, so the records need not come with the message they were read from.
+func printSection(name string, records []dns.ResourceRecord) {
+	records = slices.DeleteFunc(slices.Clone(records), func(rr dns.ResourceRecord) bool {
+		return rr.Type == dns.TypeOPT
+	})
+	if len(records) == 0 {
+		return
 	}
-	if flags&0x000F == 3 {
-		return "NXDOMAIN"
+	fmt.Printf(";; %s SECTION:\n", name)
+	for _, rr := range records {
+		fmt.Printf("%s.\t%d\tIN\t%s\t%s\n", rr.Name, rr.TTL, rr.Type, rr.RDataString(nil))
 	}
-	return "ERROR"
+	fmt.Println()
 }
 
 // getFlags extracts and formats DNS header flags into a human-readable string.
@@ -140,6 +221,7 @@ func getStatus(flags uint16) string {
 // Supported flags include:
 //   - qr: Query/Response flag (1 = response, 0 = query)
 //   - aa: Authoritative Answer flag
+//   - tc: Truncation flag
 //   - rd: Recursion Desired flag
 //   - ra: Recursion Available flag
 //
@@ -153,6 +235,9 @@ func getFlags(flags uint16) string {
 	if flags&0x0400 != 0 {
 		f = append(f, "aa")
 	}
+	if flags&0x0200 != 0 {
+		f = append(f, "tc")
+	}
 	if flags&0x0100 != 0 {
 		f = append(f, "rd")
 	}
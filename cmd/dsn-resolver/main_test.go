@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"go-dns-resolver/dns"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// capturedMX is a response to "example.com MX" whose exchange names are
+// compressed against the question and against each other.
+const capturedMX = "777781800001000200000000076578616d706c6503636f6d00000f0001c00c00" +
+	"0f000100000e100009000a046d61696cc00cc00c000f000100000e10000b0014" +
+	"066261636b7570c02b"
+
+// captureStdout returns everything f writes to standard output.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	f()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestPrintResponseCompressedAnswers(t *testing.T) {
+	raw, err := hex.DecodeString(capturedMX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := dns.Unpack(raw)
+	if err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+	// msg has no Raw bytes, like an answer served from the cache, so the names
+	// must be rendered from the parsed record data alone.
+	out := captureStdout(t, func() { printResponse(msg) })
+	for _, want := range []string{
+		"example.com.\t3600\tIN\tMX\t10 mail.example.com\n",
+		"example.com.\t3600\tIN\tMX\t20 backup.mail.example.com\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestPrintResponseEDNS(t *testing.T) {
+	msg := &dns.DNSMessage{
+		Header:    dns.Header{ID: 1, Flags: dns.FlagQR | uint16(dns.RcodeServerFailure), QDCOUNT: 1, ARCOUNT: 1},
+		Questions: []dns.Question{{Name: "example.com", Type: dns.TypeA, Class: 1}},
+	}
+	msg.SetEDNS(&dns.EDNS{UDPSize: 1232, Flags: dns.EDNSFlagDO, Options: []dns.EDNSOption{
+		dns.ExtendedError{InfoCode: dns.EDEDNSSECBogus, ExtraText: "no valid signature found"}.Option(),
+		dns.ExtendedError{InfoCode: dns.EDENoReachableAuthority}.Option(),
+	}})
+
+	out := captureStdout(t, func() { printResponse(msg) })
+	want := ";; OPT PSEUDOSECTION:\n" +
+		"; EDNS: version: 0, flags: do; udp: 1232\n" +
+		"; EDE: 6 (DNSSEC Bogus): (no valid signature found)\n" +
+		"; EDE: 22 (No Reachable Authority)\n\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("output does not contain %q:\n%s", want, out)
+	}
+	// The OPT record is shown only as the pseudosection.
+	if strings.Contains(out, "ADDITIONAL SECTION") {
+		t.Errorf("output lists the OPT record as an additional record:\n%s", out)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    options
+		wantErr bool
+	}{
+		{args: []string{"example.com"}, want: options{domain: "example.com", recordType: dns.TypeA}},
+		{args: []string{"example.com", "mx"}, want: options{domain: "example.com", recordType: dns.TypeMX}},
+		{args: []string{"example.com", "BOGUS"}, wantErr: true},
+		{args: []string{"-x", "192.0.2.1"}, want: options{domain: "1.2.0.192.in-addr.arpa", recordType: dns.TypePTR}},
+		{args: []string{"-x", "::ffff:192.0.2.1"}, want: options{domain: "1.2.0.192.in-addr.arpa", recordType: dns.TypePTR}},
+		{
+			args: []string{"-x", "2001:db8::1"},
+			want: options{
+				domain:     "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa",
+				recordType: dns.TypePTR,
+			},
+		},
+		{args: []string{"-x", "not-an-address"}, wantErr: true},
+		{args: []string{"-edns", "example.com", "AAAA"}, want: options{domain: "example.com", recordType: dns.TypeAAAA, edns: true}},
+		{args: []string{"-edns", "-x", "192.0.2.1"}, want: options{domain: "1.2.0.192.in-addr.arpa", recordType: dns.TypePTR, edns: true}},
+	}
+	for _, tt := range tests {
+		got, err := parseArgs(tt.args)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseArgs(%q) = %+v, want an error", tt.args, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseArgs(%q) = %+v, %v, want %+v", tt.args, got, err, tt.want)
+		}
+	}
+
+	// Arguments that name no query at all are answered with the usage message.
+	for _, args := range [][]string{nil, {"-x"}, {"-edns"}} {
+		if _, err := parseArgs(args); !errors.Is(err, errUsage) {
+			t.Errorf("parseArgs(%q) error = %v, want errUsage", args, err)
+		}
+	}
+}
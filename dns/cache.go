@@ -0,0 +1,335 @@
+package dns
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxNegativeTTL is the longest time a negative answer is cached when the
+// Resolver's MaxNegativeTTL is zero, following the three-hour upper bound
+// recommended by RFC 2308 section 5.
+const DefaultMaxNegativeTTL = 3 * time.Hour
+
+// StaleAnswerTTL is the TTL, in seconds, given to records served from an expired
+// cache entry, as recommended by RFC 8767 section 4.
+const StaleAnswerTTL = 30
+
+// CacheKey identifies a cached response by the question it answers. Names are
+// compared case-insensitively and without a trailing dot, so "Example.COM." and
+// "example.com" share an entry.
+type CacheKey struct {
+	Name  string     // Name is the queried domain name in lower case
+	Type  RecordType // Type is the queried record type
+	Class uint16     // Class is the queried class, usually 1 for Internet (IN)
+}
+
+// NewCacheKey builds the cache key for a question, normalizing the name.
+func NewCacheKey(name string, recordType RecordType, class uint16) CacheKey {
+	return CacheKey{
+		Name:  strings.ToLower(strings.TrimSuffix(name, ".")),
+		Type:  recordType,
+		Class: class,
+	}
+}
+
+// CacheEntry is a response stored in a Cache, together with the time it was stored
+// and the time it stops being fresh. The Resolver uses these timestamps to count
+// down the TTLs of the records it returns from the cache.
+type CacheEntry struct {
+	Message *DNSMessage // Message is the cached response; it must not be modified
+	Stored  time.Time   // Stored is when the response was received
+	Expires time.Time   // Expires is when the response stops being fresh
+}
+
+// Cache stores DNS responses for a Resolver. Implementations only provide storage;
+// the Resolver decides what to cache and for how long, and deep-copies messages,
+// record data included, on the way in and out, so stored messages are never shared
+// with callers.
+//
+// Implementations must be safe for concurrent use. MemoryCache is the in-process
+// implementation provided by this package; other implementations can back the
+// resolver with shared or persistent storage.
+type Cache interface {
+	// Get returns the entry stored under key, if any. Entries may be returned after
+	// they have expired; the Resolver checks freshness itself.
+	Get(key CacheKey) (*CacheEntry, bool)
+
+	// Set stores entry under key, replacing any previous entry.
+	Set(key CacheKey, entry *CacheEntry)
+}
+
+// MemoryCache is an in-memory Cache with least-recently-used eviction. It holds at
+// most a fixed number of entries and is safe for concurrent use.
+type MemoryCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[CacheKey]*list.Element
+	lru     *list.List // lru orders entries from most to least recently used
+}
+
+// memoryCacheItem is the value stored in each element of MemoryCache.lru.
+type memoryCacheItem struct {
+	key   CacheKey
+	entry *CacheEntry
+}
+
+// NewMemoryCache creates a MemoryCache holding at most maxEntries responses. When
+// the cache is full, storing a new response evicts the least recently used one.
+// A maxEntries of zero or less leaves the cache unbounded.
+//
+// Example:
+//
+//	resolver := dns.NewResolver("8.8.8.8:53")
+//	resolver.Cache = dns.NewMemoryCache(10000)
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    make(map[CacheKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Get returns the entry stored under key and marks it as recently used.
+func (c *MemoryCache) Get(key CacheKey) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*memoryCacheItem).entry, true
+}
+
+// Set stores entry under key, evicting the least recently used entry if the cache
+// is full.
+func (c *MemoryCache) Set(key CacheKey, entry *CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*memoryCacheItem).entry = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&memoryCacheItem{key: key, entry: entry})
+	if c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+}
+
+// Len returns the number of entries currently held by the cache.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// resolveCached answers a question through the resolver's Cache. A fresh entry is
+// returned directly, with its TTLs counted down, and may trigger a background
+// prefetch when it is close to expiring. Otherwise the upstream servers are
+// queried and the response is cached. If that refresh fails and ServeStale allows
+// it, the expired entry is returned instead, as described in RFC 8767.
+func (r *Resolver) resolveCached(ctx context.Context, key CacheKey, query []byte, queryID uint16) (*DNSMessage, error) {
+	now := r.now()
+	entry, cached := r.Cache.Get(key)
+	if cached && now.Before(entry.Expires) {
+		if r.shouldPrefetch(entry, now) {
+			r.prefetch(key, query, queryID)
+		}
+		msg := entry.Message.Copy()
+		msg.Header.ID = queryID
+		msg.decrementTTLs(uint32(now.Sub(entry.Stored) / time.Second))
+		return cachedResult(msg)
+	}
+
+	msg, err := r.refresh(ctx, key, query, queryID)
+	if err != nil && cached && r.canServeStale(entry, now, err) {
+		msg := entry.Message.Copy()
+		msg.Header.ID = queryID
+		msg.setTTLs(StaleAnswerTTL)
+		return cachedResult(msg)
+	}
+	return msg, err
+}
+
+// refresh queries the upstream servers and stores the outcome in the cache.
+// NXDOMAIN answers are cached along with successful responses.
+func (r *Resolver) refresh(ctx context.Context, key CacheKey, query []byte, queryID uint16) (*DNSMessage, error) {
+	msg, err := r.exchangeShared(ctx, key, query, queryID)
+	var respErr *ResponseError
+	if errors.As(err, &respErr) && respErr.Rcode == RcodeNameError {
+		r.cacheStore(key, respErr.Message)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.cacheStore(key, msg)
+	return msg, nil
+}
+
+// shouldPrefetch reports whether a fresh entry has entered the final fraction of
+// its lifetime given by PrefetchThreshold. Entries that are still being asked for
+// this close to expiry are popular enough to be refreshed ahead of time.
+func (r *Resolver) shouldPrefetch(entry *CacheEntry, now time.Time) bool {
+	if r.PrefetchThreshold <= 0 {
+		return false
+	}
+	lifetime := entry.Expires.Sub(entry.Stored)
+	remaining := entry.Expires.Sub(now)
+	return float64(remaining) < float64(lifetime)*r.PrefetchThreshold
+}
+
+// prefetch refreshes the entry for key in the background, so that callers keep
+// being answered from the cache. At most one prefetch per key runs at a time.
+func (r *Resolver) prefetch(key CacheKey, query []byte, queryID uint16) {
+	if _, running := r.prefetching.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+	go func() {
+		defer r.prefetching.Delete(key)
+		r.refresh(context.Background(), key, query, queryID)
+	}()
+}
+
+// canServeStale reports whether an expired entry may be returned after refreshing
+// it failed with err. The entry must have expired no longer than ServeStale ago,
+// and the failure must not be an authoritative answer such as NXDOMAIN, which
+// replaces the stale data rather than standing in for it.
+func (r *Resolver) canServeStale(entry *CacheEntry, now time.Time, err error) bool {
+	if r.ServeStale <= 0 || isDefinitive(err) {
+		return false
+	}
+	return now.Sub(entry.Expires) <= r.ServeStale
+}
+
+// now returns the current time according to the resolver's Clock.
+func (r *Resolver) now() time.Time {
+	if r.Clock != nil {
+		return r.Clock()
+	}
+	return time.Now()
+}
+
+// cachedResult turns a response taken from the cache into the result Resolve would
+// have produced for it, reporting cached NXDOMAIN answers as a *ResponseError.
+func cachedResult(msg *DNSMessage) (*DNSMessage, error) {
+	if rcode := msg.Rcode(); rcode != RcodeSuccess {
+		return nil, &ResponseError{Rcode: rcode, Message: msg}
+	}
+	return msg, nil
+}
+
+// cacheStore stores a copy of a response under key, without its Raw bytes, which
+// would not match the TTLs of the records once they are counted down. Positive
+// answers are kept for as long as their shortest-lived answer record remains
+// valid. Negative answers, NXDOMAIN or NODATA (NOERROR without answers), are kept
+// for the negative TTL of RFC 2308 derived from the SOA record in the authority
+// section. Responses with a zero TTL, and negative answers without an SOA record,
+// are not cached.
+func (r *Resolver) cacheStore(key CacheKey, msg *DNSMessage) {
+	var ttl time.Duration
+	switch rcode := msg.Rcode(); {
+	case rcode == RcodeSuccess && len(msg.Answers) > 0:
+		seconds, _ := msg.minAnswerTTL()
+		ttl = time.Duration(seconds) * time.Second
+	case rcode == RcodeSuccess || rcode == RcodeNameError:
+		ttl = r.negativeTTL(msg)
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	stored := *msg
+	stored.Raw = nil
+	now := r.now()
+	r.Cache.Set(key, &CacheEntry{
+		Message: stored.Copy(),
+		Stored:  now,
+		Expires: now.Add(ttl),
+	})
+}
+
+// negativeTTL returns how long a negative answer may be cached: the lesser of the
+// SOA record's own TTL and its MINIMUM field (RFC 2308 section 5), clamped to the
+// resolver's MinNegativeTTL and MaxNegativeTTL. It returns zero if the authority
+// section holds no usable SOA record, as such answers must not be cached.
+func (r *Resolver) negativeTTL(msg *DNSMessage) time.Duration {
+	for _, rr := range msg.Authority {
+		if rr.Type != TypeSOA {
+			continue
+		}
+		minimum, ok := soaMinimum(rr)
+		if !ok {
+			continue
+		}
+
+		maxTTL := r.MaxNegativeTTL
+		if maxTTL == 0 {
+			maxTTL = DefaultMaxNegativeTTL
+		}
+		ttl := time.Duration(min(rr.TTL, minimum)) * time.Second
+		return min(max(ttl, r.MinNegativeTTL), maxTTL)
+	}
+	return 0
+}
+
+// soaMinimum returns the MINIMUM field of an SOA record, or false if the record's
+// data could not be decoded.
+func soaMinimum(rr ResourceRecord) (uint32, bool) {
+	soa, ok := rr.Data.(*SOA)
+	if !ok {
+		return 0, false
+	}
+	return soa.Minimum, true
+}
+
+// minAnswerTTL returns the smallest TTL among the answer records, or false if the
+// message has no answers.
+func (m *DNSMessage) minAnswerTTL() (uint32, bool) {
+	if len(m.Answers) == 0 {
+		return 0, false
+	}
+	ttl := m.Answers[0].TTL
+	for _, rr := range m.Answers[1:] {
+		ttl = min(ttl, rr.TTL)
+	}
+	return ttl, true
+}
+
+// setTTLs sets the TTL of every record to ttl, skipping the OPT pseudo-record.
+func (m *DNSMessage) setTTLs(ttl uint32) {
+	for _, section := range [][]ResourceRecord{m.Answers, m.Authority, m.Additional} {
+		for i := range section {
+			if section[i].Type != TypeOPT {
+				section[i].TTL = ttl
+			}
+		}
+	}
+}
+
+// decrementTTLs reduces the TTL of every record by elapsed seconds, stopping at
+// zero. The OPT pseudo-record is skipped because its TTL field carries EDNS flags.
+func (m *DNSMessage) decrementTTLs(elapsed uint32) {
+	for _, section := range [][]ResourceRecord{m.Answers, m.Authority, m.Additional} {
+		for i := range section {
+			if section[i].Type == TypeOPT {
+				continue
+			}
+			if section[i].TTL > elapsed {
+				section[i].TTL -= elapsed
+			} else {
+				section[i].TTL = 0
+			}
+		}
+	}
+}
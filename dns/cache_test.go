@@ -0,0 +1,340 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for the Resolver's Clock hook.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Now returns the current fake time.
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// cachingResolver returns a resolver with an empty cache and a fake clock whose
+// upstream answers with a single A record built by respond. Returning a nil
+// record makes the upstream fail.
+func cachingResolver(t *testing.T, respond func(call int) *ResourceRecord) (*Resolver, *fakeClock, *atomic.Int32) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	calls := &atomic.Int32{}
+
+	resolver := NewResolver("fake")
+	resolver.Cache = NewMemoryCache(0)
+	resolver.Clock = clock.Now
+	resolver.Transport = transportFunc(func(ctx context.Context, server string, query []byte) ([]byte, error) {
+		rr := respond(int(calls.Add(1)))
+		if rr == nil {
+			return nil, errors.New("upstream unreachable")
+		}
+		return answer(query, RcodeSuccess, *rr)
+	})
+	return resolver, clock, calls
+}
+
+// aRecord returns an A record for example.com.
+func aRecord(addr string, ttl uint32) *ResourceRecord {
+	return &ResourceRecord{
+		Name: "example.com", Type: TypeA, Class: 1, TTL: ttl,
+		Data: &A{Addr: netip.MustParseAddr(addr)},
+	}
+}
+
+// resolveA resolves example.com A and returns the single answer's address and TTL.
+func resolveA(t *testing.T, resolver *Resolver) (string, uint32) {
+	t.Helper()
+	msg, err := resolver.Resolve("example.com", TypeA)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if len(msg.Answers) != 1 {
+		t.Fatalf("got %d answers, want 1", len(msg.Answers))
+	}
+	return msg.Answers[0].Data.String(), msg.Answers[0].TTL
+}
+
+func TestServeStale(t *testing.T) {
+	var failing atomic.Bool
+	resolver, clock, calls := cachingResolver(t, func(int) *ResourceRecord {
+		if failing.Load() {
+			return nil
+		}
+		return aRecord("192.0.2.1", 60)
+	})
+	resolver.ServeStale = 10 * time.Minute
+
+	if _, ttl := resolveA(t, resolver); ttl != 60 {
+		t.Fatalf("TTL = %d, want 60", ttl)
+	}
+
+	clock.Advance(30 * time.Second)
+	if _, ttl := resolveA(t, resolver); ttl != 30 {
+		t.Errorf("cached TTL = %d, want 30", ttl)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("upstream queried %d times, want 1", got)
+	}
+
+	// Expired 30 seconds ago, and the upstream is down: the stale answer is
+	// served with the RFC 8767 TTL.
+	failing.Store(true)
+	clock.Advance(60 * time.Second)
+	addr, ttl := resolveA(t, resolver)
+	if addr != "192.0.2.1" || ttl != StaleAnswerTTL {
+		t.Errorf("stale answer = %s TTL %d, want 192.0.2.1 TTL %d", addr, ttl, StaleAnswerTTL)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("upstream queried %d times, want 2", got)
+	}
+
+	// Beyond the ServeStale window the failure is reported.
+	clock.Advance(10 * time.Minute)
+	if _, err := resolver.Resolve("example.com", TypeA); err == nil {
+		t.Error("Resolve() served data expired longer than ServeStale ago")
+	}
+}
+
+func TestServeStaleNotAfterNXDOMAIN(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var nxdomain atomic.Bool
+
+	resolver := NewResolver("fake")
+	resolver.Cache = NewMemoryCache(0)
+	resolver.Clock = clock.Now
+	resolver.ServeStale = time.Hour
+	resolver.Transport = transportFunc(func(ctx context.Context, server string, query []byte) ([]byte, error) {
+		if nxdomain.Load() {
+			return answer(query, RcodeNameError)
+		}
+		return answer(query, RcodeSuccess, *aRecord("192.0.2.1", 60))
+	})
+
+	resolveA(t, resolver)
+	nxdomain.Store(true)
+	clock.Advance(2 * time.Minute)
+	if _, err := resolver.Resolve("example.com", TypeA); !errors.Is(err, ErrNameNotFound) {
+		t.Errorf("Resolve() error = %v, want ErrNameNotFound instead of stale data", err)
+	}
+}
+
+func TestPrefetchThreshold(t *testing.T) {
+	resolver, clock, calls := cachingResolver(t, func(call int) *ResourceRecord {
+		if call == 1 {
+			return aRecord("192.0.2.1", 100)
+		}
+		return aRecord("192.0.2.2", 100)
+	})
+	resolver.PrefetchThreshold = 0.1
+
+	resolveA(t, resolver)
+
+	// Half way through the lifetime, a hit does not prefetch.
+	clock.Advance(50 * time.Second)
+	resolveA(t, resolver)
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("upstream queried %d times before the threshold, want 1", got)
+	}
+
+	// In the last tenth of the lifetime, a hit is still answered from the cache
+	// but refreshes the entry in the background.
+	clock.Advance(45 * time.Second)
+	if addr, ttl := resolveA(t, resolver); addr != "192.0.2.1" || ttl != 5 {
+		t.Fatalf("answer = %s TTL %d, want the cached 192.0.2.1 TTL 5", addr, ttl)
+	}
+	prefetchedAt := clock.Now()
+	key := NewCacheKey("example.com", TypeA, 1)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if entry, ok := resolver.Cache.Get(key); ok && entry.Stored.Equal(prefetchedAt) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("prefetch did not refresh the cache entry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// After the original entry would have expired, the prefetched one answers
+	// without another upstream query.
+	clock.Advance(55 * time.Second)
+	if addr, ttl := resolveA(t, resolver); addr != "192.0.2.2" || ttl != 45 {
+		t.Errorf("answer = %s TTL %d, want the prefetched 192.0.2.2 TTL 45", addr, ttl)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("upstream queried %d times, want 2", got)
+	}
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	cache := NewMemoryCache(2)
+	keys := []CacheKey{
+		NewCacheKey("a.example.com", TypeA, 1),
+		NewCacheKey("b.example.com", TypeA, 1),
+		NewCacheKey("c.example.com", TypeA, 1),
+	}
+	entry := &CacheEntry{Message: &DNSMessage{}}
+
+	cache.Set(keys[0], entry)
+	cache.Set(keys[1], entry)
+	if got := cache.Len(); got != 2 {
+		t.Fatalf("Len() = %d, want 2", got)
+	}
+
+	// Using a makes b the least recently used entry, so c evicts b.
+	if _, ok := cache.Get(keys[0]); !ok {
+		t.Fatal("Get(a) missed")
+	}
+	cache.Set(keys[2], entry)
+	if got := cache.Len(); got != 2 {
+		t.Errorf("Len() after eviction = %d, want 2", got)
+	}
+	for i, want := range []bool{true, false, true} {
+		if _, ok := cache.Get(keys[i]); ok != want {
+			t.Errorf("Get(%s) found = %t, want %t", keys[i].Name, ok, want)
+		}
+	}
+
+	// Replacing an entry does not grow the cache.
+	cache.Set(keys[2], &CacheEntry{Message: &DNSMessage{}})
+	if got := cache.Len(); got != 2 {
+		t.Errorf("Len() after replacing an entry = %d, want 2", got)
+	}
+}
+
+func TestCachedRecordDataNotShared(t *testing.T) {
+	resolver, _, _ := cachingResolver(t, func(int) *ResourceRecord {
+		return aRecord("192.0.2.1", 60)
+	})
+
+	for range 2 {
+		msg, err := resolver.Resolve("example.com", TypeA)
+		if err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+		a := msg.Answers[0].Data.(*A)
+		if got := a.Addr.String(); got != "192.0.2.1" {
+			t.Fatalf("answer = %s, want 192.0.2.1", got)
+		}
+		a.Addr = netip.MustParseAddr("203.0.113.66")
+	}
+}
+
+func TestNegativeCaching(t *testing.T) {
+	soa := func(ttl, minimum uint32) []ResourceRecord {
+		return []ResourceRecord{{
+			Name: "example.com", Type: TypeSOA, Class: 1, TTL: ttl,
+			Data: &SOA{
+				MName: "ns1.example.com", RName: "hostmaster.example.com", Serial: 2024010101,
+				Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: minimum,
+			},
+		}}
+	}
+	tests := []struct {
+		name      string
+		rcode     Rcode
+		authority []ResourceRecord
+		min, max  time.Duration // min and max are the resolver's negative TTL bounds
+		want      time.Duration // want is the cached lifetime, zero for not cached
+	}{
+		{name: "NXDOMAIN uses MINIMUM", rcode: RcodeNameError, authority: soa(3600, 300), want: 300 * time.Second},
+		{name: "NXDOMAIN uses SOA TTL", rcode: RcodeNameError, authority: soa(120, 300), want: 120 * time.Second},
+		{name: "NODATA uses MINIMUM", rcode: RcodeSuccess, authority: soa(3600, 600), want: 600 * time.Second},
+		{name: "NODATA uses SOA TTL", rcode: RcodeSuccess, authority: soa(60, 600), want: 60 * time.Second},
+		{
+			name: "raised to MinNegativeTTL", rcode: RcodeNameError, authority: soa(3600, 5),
+			min: 30 * time.Second, want: 30 * time.Second,
+		},
+		{
+			name: "lowered to MaxNegativeTTL", rcode: RcodeNameError, authority: soa(86400, 86400),
+			max: time.Hour, want: time.Hour,
+		},
+		{
+			name: "lowered to DefaultMaxNegativeTTL", rcode: RcodeSuccess, authority: soa(86400, 86400),
+			want: DefaultMaxNegativeTTL,
+		},
+		{name: "NXDOMAIN without SOA", rcode: RcodeNameError},
+		{name: "NODATA without SOA", rcode: RcodeSuccess},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+			var calls atomic.Int32
+
+			resolver := NewResolver("fake")
+			resolver.Cache = NewMemoryCache(0)
+			resolver.Clock = clock.Now
+			resolver.MinNegativeTTL = tt.min
+			resolver.MaxNegativeTTL = tt.max
+			resolver.Transport = transportFunc(func(ctx context.Context, server string, query []byte) ([]byte, error) {
+				calls.Add(1)
+				msg, err := Unpack(query)
+				if err != nil {
+					return nil, err
+				}
+				msg.Header.Flags |= FlagQR | uint16(tt.rcode)
+				msg.Authority = tt.authority
+				return msg.Pack()
+			})
+
+			resolve := func() {
+				t.Helper()
+				msg, err := resolver.Resolve("www.example.com", TypeA)
+				if tt.rcode == RcodeNameError && !errors.Is(err, ErrNameNotFound) {
+					t.Fatalf("Resolve() error = %v, want ErrNameNotFound", err)
+				}
+				if tt.rcode == RcodeSuccess && (err != nil || len(msg.Answers) != 0) {
+					t.Fatalf("Resolve() = %v, %v, want an empty answer", msg, err)
+				}
+			}
+
+			resolve()
+			entry, ok := resolver.Cache.Get(NewCacheKey("www.example.com", TypeA, 1))
+			if tt.want == 0 {
+				if ok {
+					t.Fatalf("answer cached for %v, want it not cached", entry.Expires.Sub(entry.Stored))
+				}
+				resolve()
+				if got := calls.Load(); got != 2 {
+					t.Errorf("upstream queried %d times, want 2", got)
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("negative answer not cached")
+			}
+			if got := entry.Expires.Sub(entry.Stored); got != tt.want {
+				t.Errorf("cached for %v, want %v", got, tt.want)
+			}
+
+			// The cached answer is served until it expires.
+			clock.Advance(tt.want - time.Second)
+			resolve()
+			if got := calls.Load(); got != 1 {
+				t.Errorf("upstream queried %d times within the negative TTL, want 1", got)
+			}
+			clock.Advance(time.Second)
+			resolve()
+			if got := calls.Load(); got != 2 {
+				t.Errorf("upstream queried %d times after the negative TTL, want 2", got)
+			}
+		})
+	}
+}
@@ -1,10 +1,11 @@
 // Package dns provides a simple DNS client for resolving domain names.
 // It implements the core DNS protocol as defined in RFC 1035, supporting
-// UDP transport and various record types including A, AAAA, CNAME, MX, TXT, and NS.
+// UDP transport with automatic TCP fallback and various record types including A, AAAA, CNAME, MX, TXT, NS, SOA, PTR, SRV, SVCB, and HTTPS.
+// Upstreams may also be reached over DNS-over-TLS (RFC 7858) and DNS-over-HTTPS (RFC 8484).
 //
 // The package offers a high-level Resolver type that handles DNS query construction,
 // transmission, and response parsing. It supports standard DNS features including
-// message compression and proper error handling for common DNS response codes.
+// message compression, EDNS(0) and proper error handling for common DNS response codes.
 //
 // Example usage:
 //
@@ -13,41 +14,138 @@
 //	if err != nil {
 //		log.Fatal(err)
 //	}
-//	// Process response.Answers for IPv4 addresses
+//	for _, answer := range response.Answers {
+//		if a, ok := answer.Data.(*dns.A); ok {
+//			fmt.Println(a.Addr)
+//		}
+//	}
+//
+// Every lookup method has a context-aware variant (for example ResolveContext)
+// whose context cancels the network exchange and bounds it by its deadline.
 package dns
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	mathrand "math/rand/v2"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var (
-	// ErrNameNotFound indicates that the queried domain name does not exist.
-	// This corresponds to the NXDOMAIN response code (RCODE 3) in DNS responses.
-	ErrNameNotFound = errors.New("domain name not found (NXDOMAIN)")
-
-	// ErrServerFailed indicates that the DNS server was unable to process the query.
-	// This corresponds to the SERVFAIL response code (RCODE 2) in DNS responses
-	// and typically indicates a problem with the authoritative server or network.
-	ErrServerFailed = errors.New("server failure (SERVFAIL)")
-)
-
-// Resolver provides DNS resolution functionality using UDP transport.
-// It encapsulates the configuration needed to communicate with a DNS server
-// and provides methods for constructing queries, sending them over the network,
-// and parsing responses according to RFC 1035.
+// Resolver provides DNS resolution functionality using UDP transport, falling back
+// to TCP when a response is truncated. It encapsulates the configuration needed to
+// communicate with one or more DNS servers and provides methods for constructing
+// queries, sending them over the network, and parsing responses according to RFC 1035.
 //
 // The resolver maintains connection details including the target DNS server
-// address and timeout settings for network operations. It handles the complete
-// DNS query lifecycle from message construction to response validation.
+// addresses and timeout settings for network operations. It handles the complete
+// DNS query lifecycle from message construction to response validation, failing
+// over between upstream servers when one of them does not produce an answer.
+// How messages travel to each server is delegated to a Transport, which can be
+// replaced to reach upstreams by other means.
+//
+// A Resolver must not be copied after first use.
 type Resolver struct {
 	ServerAddr string        // ServerAddr is the network address of the DNS server (e.g., "8.8.8.8:53")
-	Timeout    time.Duration // Timeout specifies the maximum duration for DNS query operations
+	Timeout    time.Duration // Timeout specifies the maximum duration for DNS query operations, across all attempts
+	ForceTCP   bool          // ForceTCP sends every query over TCP instead of trying UDP first
+
+	// Servers lists the upstream servers to query, in order of preference. When empty,
+	// ServerAddr is used as the only upstream.
+	Servers []string
+
+	// Strategy selects how queries are distributed across Servers.
+	Strategy Strategy
+
+	// AttemptTimeout bounds a single query to a single server. When zero, an attempt
+	// may use all of the time remaining under Timeout.
+	AttemptTimeout time.Duration
+
+	// Attempts is the number of passes made over the server list before giving up.
+	// Values less than one are treated as one.
+	Attempts int
+
+	// Cache, when non-nil, stores successful responses and answers repeated questions
+	// without contacting the upstream servers until the records' TTLs run out.
+	// Records returned from the cache carry their remaining TTL. NXDOMAIN and NODATA
+	// answers are cached as well, as described in RFC 2308.
+	Cache Cache
+
+	// MinNegativeTTL and MaxNegativeTTL clamp how long NXDOMAIN and NODATA answers
+	// are cached. A zero MaxNegativeTTL means DefaultMaxNegativeTTL.
+	MinNegativeTTL time.Duration
+	MaxNegativeTTL time.Duration
+
+	// ServeStale is how long after expiry a cached response may still be returned
+	// when refreshing it fails, as described in RFC 8767. Stale records are returned
+	// with a TTL of StaleAnswerTTL. Zero disables serving stale data.
+	ServeStale time.Duration
+
+	// PrefetchThreshold is the fraction of a cached response's lifetime, between 0
+	// and 1, below which a cache hit also refreshes the response in the background.
+	// For example, 0.1 prefetches entries requested during their last tenth of
+	// validity. Zero disables prefetching.
+	PrefetchThreshold float64
+
+	// Clock returns the current time for cache expiry decisions. When nil, time.Now
+	// is used; tests can substitute a fake clock.
+	Clock func() time.Time
+
+	// Rand supplies the randomness for weighted SRV target selection in LookupSRV.
+	// When nil, a randomly seeded source is used; tests can substitute a seeded
+	// generator to make the order reproducible. Uses of Rand are serialized by the
+	// resolver, but it must not be shared with other code.
+	Rand *mathrand.Rand
+
+	// EDNS, when non-nil, adds an OPT pseudo-record to every query advertising the
+	// given UDP payload size, flags and version, and sizes UDP receive buffers to
+	// match. When nil, queries are plain RFC 1035 messages limited to 512 bytes.
+	EDNS *EDNS
+
+	// UDPPool, when non-nil, carries UDP queries over the pool's long-lived sockets
+	// instead of dialing a new socket for every query. A pool may be shared between
+	// resolvers and must be closed by its owner.
+	UDPPool *UDPPool
+
+	// TLSTransport carries queries to upstreams whose address starts with TLSScheme,
+	// such as "tls://9.9.9.9:853", over DNS-over-TLS. When nil, a transport with the
+	// default TLS configuration is used. Other upstreams are unaffected, so
+	// encrypted and plain servers can be mixed in Servers.
+	TLSTransport *TLSTransport
+
+	// HTTPSTransport carries queries to upstreams whose address starts with
+	// HTTPSScheme, such as "https://dns.google/dns-query", over DNS-over-HTTPS.
+	// When nil, POST requests are sent with http.DefaultClient.
+	HTTPSTransport *HTTPSTransport
+
+	// CaseRandomization enables DNS 0x20 encoding: the letters of each query name
+	// are sent in random case, and the response must echo the name byte for byte.
+	// This makes forged responses harder to get accepted, since an off-path
+	// attacker must also guess the case pattern. A response with the name's case
+	// changed is discarded and the server asked again under a fresh ID and case
+	// pattern; only if that answer also changes the case is the upstream held to
+	// case-insensitive matching, for half an hour before it is tested again.
+	CaseRandomization bool
+
+	// Transport, when non-nil, carries every query instead of the built-in
+	// transports, regardless of the upstream address scheme. ForceTCP, UDPPool,
+	// TLSTransport and HTTPSTransport are then ignored.
+	Transport Transport
+
+	next            atomic.Uint32  // next is the rotation counter used by StrategyRoundRobin
+	randMu          sync.Mutex     // randMu serializes uses of Rand
+	prefetching     sync.Map       // prefetching holds the cache keys with a prefetch in flight
+	flights         flightGroup    // flights coalesces identical questions that are in flight
+	caseNormalizing sync.Map       // caseNormalizing maps servers that do not preserve query name case to when that expires
+	defaultTLS      TLSTransport   // defaultTLS serves "tls://" upstreams when TLSTransport is nil
+	defaultDoH      HTTPSTransport // defaultDoH serves "https://" upstreams when HTTPSTransport is nil
 }
 
 // NewResolver creates a new DNS resolver configured to use the specified server.
@@ -60,6 +158,12 @@ type Resolver struct {
 //	resolver := NewResolver("8.8.8.8:53")      // Google Public DNS
 //	resolver := NewResolver("1.1.1.1:53")      // Cloudflare DNS
 //	resolver := NewResolver("localhost:5353")   // Local DNS server
+//
+// To fail over between several upstreams, set Servers on the returned resolver:
+//
+//	resolver := NewResolver("8.8.8.8:53")
+//	resolver.Servers = []string{"8.8.8.8:53", "1.1.1.1:53"}
+//	resolver.AttemptTimeout = time.Second
 func NewResolver(serverAddr string) *Resolver {
 	return &Resolver{
 		ServerAddr: serverAddr,
@@ -77,12 +181,24 @@ func NewResolver(serverAddr string) *Resolver {
 //   - Network transmission with timeout protection
 //   - Response validation and error code handling
 //   - Parsing of DNS message compression
+//   - Retaining the raw response bytes in DNSMessage.Raw
+//   - Answering from the resolver's Cache when one is configured
+//   - Sharing a single upstream query among concurrent callers asking the same question
 //
 // Common record types include TypeA for IPv4 addresses, TypeAAAA for IPv6,
 // TypeCNAME for aliases, and TypeMX for mail servers.
 //
+// When several upstream Servers are configured, they are tried according to the
+// resolver's Strategy until one answers; see Servers, AttemptTimeout and Attempts.
+//
 // Returns an error for network failures, malformed responses, DNS error codes
-// (NXDOMAIN, SERVFAIL), or query/response ID mismatches.
+// (NXDOMAIN, SERVFAIL, REFUSED and others), or query/response ID mismatches.
+// DNS error codes are reported as a *ResponseError carrying the full response.
+// If no upstream produced an answer, the error is an *UpstreamError listing each
+// failure.
+//
+// Resolve is equivalent to ResolveContext with context.Background; use
+// ResolveContext to cancel a lookup or bound it by a caller-supplied deadline.
 //
 // Example:
 //
@@ -91,31 +207,136 @@ func NewResolver(serverAddr string) *Resolver {
 //		return err
 //	}
 //	for _, answer := range msg.Answers {
-//		// Process IPv4 addresses from answer.RData
+//		// Process IPv4 addresses from answer.Data.(*A).Addr
 //	}
 func (r *Resolver) Resolve(domainName string, recordType RecordType) (*DNSMessage, error) {
+	return r.ResolveContext(context.Background(), domainName, recordType)
+}
+
+// ResolveContext performs a DNS query like Resolve, but honors the cancellation
+// and deadline of the provided context. The context governs every network step of
+// the lookup, including dialing, writing the query, and waiting for the response,
+// so abandoning the surrounding operation promptly releases the socket.
+//
+// The resolver's Timeout still applies; whichever of the context deadline and
+// Timeout expires first bounds the query. When the context is cancelled or its
+// deadline passes, the returned error wraps ctx.Err().
+//
+// Example:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+//	defer cancel()
+//	msg, err := resolver.ResolveContext(ctx, "example.com", TypeA)
+func (r *Resolver) ResolveContext(ctx context.Context, domainName string, recordType RecordType) (*DNSMessage, error) {
 	query, queryID, err := r.buildQuery(domainName, recordType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build query: %w", err)
 	}
 
-	responseBytes, err := r.sendQuery(query)
+	key := NewCacheKey(domainName, recordType, 1)
+	if r.Cache == nil {
+		return r.exchangeShared(ctx, key, query, queryID)
+	}
+	return r.resolveCached(ctx, key, query, queryID)
+}
+
+// queryServer sends a single query to one server and returns the parsed response.
+// The attempt is bounded by AttemptTimeout in addition to the supplied context.
+// The response is validated against the query, and a mismatch is reported as an
+// error matching ErrInvalidResponse; DNS error codes are reported as a
+// *ResponseError whose message records the raw bytes and the server.
+//
+// With CaseRandomization, a response that echoes the question in a different case
+// may be a forgery, so it is discarded and the server is asked again with a fresh
+// ID and case pattern. Only if that answer also fails to preserve the case is the
+// server taken to normalize names, and held to case-insensitive matching for
+// caseNormalizingTTL.
+func (r *Resolver) queryServer(ctx context.Context, server string, query []byte) (*DNSMessage, error) {
+	if r.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.AttemptTimeout)
+		defer cancel()
+	}
+
+	exactCase := r.CaseRandomization && !r.normalizesCase(server)
+	msg, err := r.exchangeWith(ctx, server, query, exactCase)
+	var caseErr *CaseMismatchError
+	if !errors.As(err, &caseErr) {
+		return msg, err
+	}
+
+	probe, err := r.requery(query)
+	if err != nil {
+		return nil, err
+	}
+	msg, err = r.exchangeWith(ctx, server, probe, true)
+	if errors.As(err, &caseErr) {
+		// A forger would have had to guess the new ID and case pattern as well,
+		// so the server itself does not preserve case.
+		r.caseNormalizing.Store(server, r.now().Add(caseNormalizingTTL))
+		if probe, err = r.requery(query); err != nil {
+			return nil, err
+		}
+		msg, err = r.exchangeWith(ctx, server, probe, false)
+	}
+	return withID(msg, err, binary.BigEndian.Uint16(query))
+}
+
+// exchangeWith sends query to server and returns the parsed and validated
+// response, requiring the question name's case to be echoed when exactCase is set.
+func (r *Resolver) exchangeWith(ctx context.Context, server string, query []byte, exactCase bool) (*DNSMessage, error) {
+	responseBytes, err := r.sendQuery(ctx, server, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send query: %w", err)
 	}
 
 	msg, err := parseResponse(responseBytes)
-	if err != nil {
+	var respErr *ResponseError
+	if errors.As(err, &respErr) {
+		msg = respErr.Message
+	} else if err != nil {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	if msg.Header.ID != queryID {
-		return nil, fmt.Errorf("response ID %d does not match query ID %d", msg.Header.ID, queryID)
+	if err := validateResponse(msg, query, exactCase); err != nil {
+		return nil, err
 	}
+	msg.Raw = responseBytes
+	msg.Server = server
 
+	if respErr != nil {
+		return nil, respErr
+	}
 	return msg, nil
 }
 
+// requery returns a query asking the same question as query under a fresh ID and,
+// with CaseRandomization, a fresh case pattern.
+func (r *Resolver) requery(query []byte) ([]byte, error) {
+	question, _, err := parseQuestion(query, 12)
+	if err != nil {
+		return nil, err
+	}
+	requery, _, err := r.buildQuery(question.Name, question.Type)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+	return requery, nil
+}
+
+// withID gives the response to a requery, which may be carried by a
+// *ResponseError, the ID of the query it stands in for.
+func withID(msg *DNSMessage, err error, id uint16) (*DNSMessage, error) {
+	var respErr *ResponseError
+	if errors.As(err, &respErr) {
+		respErr.Message.setID(id)
+	}
+	if msg != nil {
+		msg.setID(id)
+	}
+	return msg, err
+}
+
 // buildQuery constructs a binary DNS query message for the given domain and record type.
 // It generates a random query ID for matching requests with responses, creates a standard
 // query header with the recursion desired flag set, and encodes the question section
@@ -128,7 +349,11 @@ func (r *Resolver) Resolve(domainName string, recordType RecordType) (*DNSMessag
 // The resulting query follows RFC 1035 format with:
 //   - 12-byte header containing ID, flags, and section counts
 //   - Question section with encoded domain name, type, and class
-//   - No answer, authority, or additional sections for queries
+//   - No answer or authority sections for queries
+//   - An OPT pseudo-record in the additional section when EDNS is configured
+//
+// When CaseRandomization is set, the letters of the query name are given a random
+// case, which the response must echo exactly.
 func (r *Resolver) buildQuery(domainName string, recordType RecordType) ([]byte, uint16, error) {
 	idBytes := make([]byte, 2)
 	_, err := rand.Read(idBytes)
@@ -137,11 +362,21 @@ func (r *Resolver) buildQuery(domainName string, recordType RecordType) ([]byte,
 	}
 	id := binary.BigEndian.Uint16(idBytes)
 
+	if r.CaseRandomization {
+		domainName, err = randomizeCase(domainName)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to randomize name case: %w", err)
+		}
+	}
+
 	header := Header{
 		ID:      id,
-		Flags:   0x0100, // Standard query (RD flag set)
+		Flags:   FlagRD, // Standard query (RD flag set)
 		QDCOUNT: 1,
 	}
+	if r.EDNS != nil {
+		header.ARCOUNT = 1
+	}
 
 	question := Question{
 		Name:  domainName,
@@ -162,105 +397,172 @@ func (r *Resolver) buildQuery(domainName string, recordType RecordType) ([]byte,
 	}
 	buf.Write(questionBytes)
 
+	if r.EDNS != nil {
+		opt := r.EDNS.record()
+		if err := opt.pack(&buf, nil); err != nil {
+			return nil, 0, fmt.Errorf("failed to pack OPT record: %w", err)
+		}
+	}
+
 	return buf.Bytes(), id, nil
 }
 
-// sendQuery transmits a DNS query to the configured server and returns the response.
-// It establishes a UDP connection to the DNS server, applies the configured timeout
-// to prevent indefinite blocking, sends the query bytes, and reads the response.
-//
-// The method handles network-level concerns including:
-//   - UDP connection establishment and cleanup
-//   - Timeout configuration for both read and write operations
-//   - Response buffer sizing (512 bytes per RFC 1035 recommendations)
-//   - Proper connection closure to prevent resource leaks
+// randomizeCase returns name with the case of each ASCII letter chosen at random,
+// as proposed by draft-vixie-dnsext-dns0x20. Each letter adds one bit that an
+// off-path attacker must guess on top of the query ID and source port.
+func randomizeCase(name string) (string, error) {
+	random := make([]byte, len(name))
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	randomized := []byte(name)
+	for i, c := range randomized {
+		if ('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') && random[i]&1 == 1 {
+			randomized[i] = c ^ 0x20
+		}
+	}
+	return string(randomized), nil
+}
+
+// caseNormalizingTTL is how long a server found not to preserve the case of query
+// names is held only to case-insensitive matching before it is tested again.
+const caseNormalizingTTL = 30 * time.Minute
+
+// normalizesCase reports whether server has recently been seen answering with a
+// question name whose case differs from the query's, so that exact case matching
+// must not be required of it.
+func (r *Resolver) normalizesCase(server string) bool {
+	until, ok := r.caseNormalizing.Load(server)
+	if !ok {
+		return false
+	}
+	if r.now().Before(until.(time.Time)) {
+		return true
+	}
+	r.caseNormalizing.CompareAndDelete(server, until)
+	return false
+}
+
+// sendQuery transmits a DNS query to the given server through the transport
+// selected for it by transport, and returns the raw response bytes as received.
 //
-// Returns the raw response bytes as received from the server, or an error if
-// the network operation fails, times out, or the server is unreachable.
+// The context bounds the whole exchange, including a TCP retry, and cancellation
+// interrupts blocked I/O.
 //
 // The response bytes can be parsed using parseResponse to extract the structured
 // DNS message components.
-func (r *Resolver) sendQuery(query []byte) ([]byte, error) {
-	conn, err := net.Dial("udp", r.ServerAddr)
+func (r *Resolver) sendQuery(ctx context.Context, server string, query []byte) ([]byte, error) {
+	return r.transport(server).Exchange(ctx, server, query)
+}
+
+// dialContext connects to the DNS server and ties the lifetime of the returned
+// connection's I/O to the context. The context deadline becomes the connection
+// deadline, and cancelling the context unblocks any pending read or write.
+// The returned connection must be closed by the caller, which also releases the
+// cancellation hook.
+func dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to DNS server: %w", err)
+		return nil, err
 	}
-	defer conn.Close()
 
-	conn.SetDeadline(time.Now().Add(r.Timeout))
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
 
-	_, err = conn.Write(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send query: %w", err)
+	return &contextConn{Conn: conn, stop: stop}, nil
+}
+
+// contextConn wraps a net.Conn so that closing it also detaches the context
+// cancellation hook installed by dialContext.
+type contextConn struct {
+	net.Conn
+	stop func() bool
+}
+
+// Close detaches the cancellation hook and closes the underlying connection.
+func (c *contextConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
+
+// contextError prefers the context's error over a network error caused by the
+// context expiring, so callers can match context.Canceled and
+// context.DeadlineExceeded with errors.Is.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
 	}
+	return err
+}
 
-	response := make([]byte, 512)
-	n, err := conn.Read(response)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+// writeTCPMessage writes a DNS message to a stream connection using the two-byte
+// length prefix required for TCP transport.
+func writeTCPMessage(w io.Writer, message []byte) error {
+	if len(message) > 0xFFFF {
+		return fmt.Errorf("message of %d bytes exceeds maximum TCP message size", len(message))
 	}
+	framed := make([]byte, 2+len(message))
+	binary.BigEndian.PutUint16(framed[:2], uint16(len(message)))
+	copy(framed[2:], message)
+	_, err := w.Write(framed)
+	return err
+}
 
-	return response[:n], nil
+// readTCPMessage reads a single length-prefixed DNS message from a stream connection.
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	message := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, err
+	}
+	return message, nil
 }
 
 // parseResponse parses a raw DNS response message into a structured DNSMessage.
-// It validates the response header, checks for DNS error codes, and extracts
-// all sections of the DNS message including questions, answers, authority,
-// and additional records.
+// It uses Unpack to extract all sections of the DNS message including questions,
+// answers, authority, and additional records, and then checks the response code.
 //
-// The function handles DNS protocol details including:
-//   - Header validation and error code interpretation
-//   - DNS message compression for domain names
-//   - Proper offset tracking through variable-length sections
-//   - Resource record parsing with type-specific data handling
+// Any response code other than NOERROR, including EDNS extended codes, is reported
+// as a *ResponseError that carries the parsed message and matches the sentinel
+// error for its code, for example:
+//   - RCODE 2 (SERVFAIL) matches ErrServerFailed
+//   - RCODE 3 (NXDOMAIN) matches ErrNameNotFound
+//   - RCODE 5 (REFUSED) matches ErrRefused
 //
-// DNS error codes are mapped to appropriate Go errors:
-//   - RCODE 2 (SERVFAIL) returns ErrServerFailed
-//   - RCODE 3 (NXDOMAIN) returns ErrNameNotFound
-//   - Other error codes return generic parsing errors
-//
-// The function currently parses questions and answer sections completely,
-// with partial implementation for authority and additional sections.
+// All four sections are parsed in wire order, so SOA records in the authority
+// section and glue records in the additional section are available to callers,
+// including on negative answers.
 //
 // Returns a fully populated DNSMessage structure or an error if the response
 // is malformed, contains unsupported features, or indicates a DNS-level error.
+// If an error response cannot be fully parsed, the *ResponseError carries a
+// message holding only the header.
 func parseResponse(response []byte) (*DNSMessage, error) {
 	header, err := UnpackHeader(response)
 	if err != nil {
 		return nil, err
 	}
 
-	responseCode := header.Flags & 0x000F
-	if responseCode == 2 {
-		return nil, ErrServerFailed
-	}
-	if responseCode == 3 {
-		return nil, ErrNameNotFound
-	}
-
-	offset := 12
-	msg := &DNSMessage{Header: header}
-
-	// Parse Questions
-	for i := 0; i < int(header.QDCOUNT); i++ {
-		q, n, err := parseQuestion(response, offset)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse question %d: %w", i, err)
+	msg, err := Unpack(response)
+	if err != nil {
+		if rcode := Rcode(header.Flags & 0x000F); rcode != RcodeSuccess {
+			return nil, &ResponseError{Rcode: rcode, Message: &DNSMessage{Header: header}}
 		}
-		msg.Questions = append(msg.Questions, q)
-		offset += n
+		return nil, err
 	}
 
-	// Parse Answers, Authority, and Additional records
-	for i := 0; i < int(header.ANCOUNT); i++ {
-		rr, n, err := ParseResourceRecord(response, offset)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse answer %d: %w", i, err)
-		}
-		msg.Answers = append(msg.Answers, rr)
-		offset += n
+	if rcode := msg.Rcode(); rcode != RcodeSuccess {
+		return nil, &ResponseError{Rcode: rcode, Message: msg}
 	}
-	// ... repeat for NSCOUNT and ARCOUNT ...
 
 	return msg, nil
 }
@@ -277,8 +579,8 @@ func parseResponse(response []byte) (*DNSMessage, error) {
 // Returns the parsed Question structure, the byte count consumed from the original
 // offset position, and any error encountered during parsing or validation.
 //
-// This function is used internally by parseResponse to process the question section
-// of DNS response messages.
+// This function is used internally by Unpack to process the question section
+// of DNS messages.
 func parseQuestion(message []byte, offset int) (Question, int, error) {
 	var q Question
 	name, nameLen, err := DecodeDomainName(message, offset)
@@ -0,0 +1,245 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Responses captured from the wire. Every name after the question is compressed
+// against an earlier part of the message, as servers do.
+const (
+	// nonexistent.example.com A: NXDOMAIN with the zone's SOA in the authority
+	// section and an OPT record in the additional section.
+	capturedNXDOMAIN = "1c2b818300010000000100010b6e6f6e6578697374656e74076578616d706c65" +
+		"03636f6d0000010001c0180006000100000e10002c026e73056963616e6e036f" +
+		"726700036e6f6303646e73c03878a5083a00001c2000000e100012750000000e" +
+		"1000002904d0000000000000"
+
+	// www.example.org A: a referral from the org servers, with no answer, the
+	// delegation in the authority section and glue in the additional section.
+	capturedReferral = "4d218000000100000002000303777777076578616d706c65036f726700000100" +
+		"01c010000200010002a300001401610c69616e612d73657276657273036e6574" +
+		"00c010000200010002a30000040162c02fc02d000100010002a3000004c72b87" +
+		"35c02d001c00010002a300001020010500008f00000000000000000053000029" +
+		"04d0000000000000"
+
+	// www.example.net A: a CNAME chain in the answer section, the zone's name
+	// server in the authority section and its address in the additional section.
+	capturedCNAME = "0a0b8180000100020001000103777777076578616d706c65036e657400000100" +
+		"01c00c000500010000012c00070465646765c010c02d000100010000003c0004" +
+		"c000020ac01000020001000151800006036e7331c010c0500001000100015180" +
+		"0004c0000235"
+
+	// example.com MX: two exchanges whose names are compressed against the
+	// question and against each other.
+	capturedMX = "777781800001000200000000076578616d706c6503636f6d00000f0001c00c00" +
+		"0f000100000e100009000a046d61696cc00cc00c000f000100000e10000b0014" +
+		"066261636b7570c02b"
+)
+
+// mustDecodeHex decodes a hexadecimal test fixture.
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex fixture: %v", err)
+	}
+	return b
+}
+
+// transportFunc adapts a function to the Transport interface.
+type transportFunc func(ctx context.Context, server string, query []byte) ([]byte, error)
+
+// Exchange calls f.
+func (f transportFunc) Exchange(ctx context.Context, server string, query []byte) ([]byte, error) {
+	return f(ctx, server, query)
+}
+
+// answer returns a packed response to query with the given code and answer
+// records. Pack compresses every name against earlier parts of the message.
+// It reports errors rather than failing the test because transports and test
+// servers call it from goroutines other than the test's own.
+func answer(query []byte, rcode Rcode, answers ...ResourceRecord) ([]byte, error) {
+	msg, err := Unpack(query)
+	if err != nil {
+		return nil, fmt.Errorf("unpack query: %w", err)
+	}
+	msg.Header.Flags |= FlagQR | uint16(rcode)
+	msg.Answers = answers
+	msg.Additional = nil
+	return msg.Pack()
+}
+
+// formatRecords renders records as "name TTL TYPE data" for comparison.
+func formatRecords(records []ResourceRecord) []string {
+	var out []string
+	for _, rr := range records {
+		out = append(out, fmt.Sprintf("%s %d %s %s", rr.Name, rr.TTL, rr.Type, rr.Data))
+	}
+	return out
+}
+
+func TestParseResponseSections(t *testing.T) {
+	tests := []struct {
+		name           string
+		response       string
+		wantRcode      Rcode
+		wantAnswers    []string
+		wantAuthority  []string
+		wantAdditional []string
+	}{
+		{
+			name:      "NXDOMAIN with SOA",
+			response:  capturedNXDOMAIN,
+			wantRcode: RcodeNameError,
+			wantAuthority: []string{
+				"example.com 3600 SOA ns.icann.org noc.dns.icann.org 2024081466 7200 3600 1209600 3600",
+			},
+			wantAdditional: []string{" 0 OPT "},
+		},
+		{
+			name:     "referral with glue",
+			response: capturedReferral,
+			wantAuthority: []string{
+				"example.org 172800 NS a.iana-servers.net",
+				"example.org 172800 NS b.iana-servers.net",
+			},
+			wantAdditional: []string{
+				"a.iana-servers.net 172800 A 199.43.135.53",
+				"a.iana-servers.net 172800 AAAA 2001:500:8f::53",
+				" 0 OPT ",
+			},
+		},
+		{
+			name:     "CNAME chain",
+			response: capturedCNAME,
+			wantAnswers: []string{
+				"www.example.net 300 CNAME edge.example.net",
+				"edge.example.net 60 A 192.0.2.10",
+			},
+			wantAuthority:  []string{"example.net 86400 NS ns1.example.net"},
+			wantAdditional: []string{"ns1.example.net 86400 A 192.0.2.53"},
+		},
+		{
+			name:     "MX",
+			response: capturedMX,
+			wantAnswers: []string{
+				"example.com 3600 MX 10 mail.example.com",
+				"example.com 3600 MX 20 backup.mail.example.com",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := parseResponse(mustDecodeHex(t, tt.response))
+			var respErr *ResponseError
+			switch {
+			case errors.As(err, &respErr):
+				msg = respErr.Message
+			case err != nil:
+				t.Fatalf("parseResponse() error = %v", err)
+			}
+
+			if got := msg.Rcode(); got != tt.wantRcode {
+				t.Errorf("Rcode() = %s, want %s", got, tt.wantRcode)
+			}
+			if got, want := len(msg.Answers)+len(msg.Authority)+len(msg.Additional),
+				int(msg.Header.ANCOUNT+msg.Header.NSCOUNT+msg.Header.ARCOUNT); got != want {
+				t.Errorf("parsed %d records, header counts %d", got, want)
+			}
+			compareRecords(t, "answer", msg.Answers, tt.wantAnswers)
+			compareRecords(t, "authority", msg.Authority, tt.wantAuthority)
+			compareRecords(t, "additional", msg.Additional, tt.wantAdditional)
+		})
+	}
+}
+
+// compareRecords reports a test error if records do not render as want.
+func compareRecords(t *testing.T, section string, records []ResourceRecord, want []string) {
+	t.Helper()
+	got := formatRecords(records)
+	if len(got) != len(want) {
+		t.Errorf("%s section = %q, want %q", section, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s record %d = %q, want %q", section, i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseResponseTruncatedSection(t *testing.T) {
+	// Dropping the last bytes cuts the additional section short, which must be
+	// reported rather than silently ignored.
+	response := mustDecodeHex(t, capturedCNAME)
+	if _, err := parseResponse(response[:len(response)-3]); err == nil {
+		t.Fatal("parseResponse() succeeded on a truncated response")
+	}
+}
+
+func TestResolveRendersCompressedRecords(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordType RecordType
+		data       RData
+		want       string
+		expanded   string // expanded is a name in data that must be compressed on the wire
+	}{
+		{
+			name:       "CNAME",
+			recordType: TypeCNAME,
+			data:       &CNAME{Target: "www.example.com"},
+			want:       "www.example.com",
+			expanded:   "\x03www\x07example\x03com\x00",
+		},
+		{
+			name:       "NS",
+			recordType: TypeNS,
+			data:       &NS{Host: "ns1.example.com"},
+			want:       "ns1.example.com",
+			expanded:   "\x03ns1\x07example\x03com\x00",
+		},
+		{
+			name:       "MX",
+			recordType: TypeMX,
+			data:       &MX{Preference: 10, Exchange: "mail.example.com"},
+			want:       "10 mail.example.com",
+			expanded:   "\x04mail\x07example\x03com\x00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []byte
+			resolver := NewResolver("fake")
+			resolver.Transport = transportFunc(func(ctx context.Context, server string, query []byte) ([]byte, error) {
+				var err error
+				sent, err = answer(query, RcodeSuccess, ResourceRecord{
+					Name: "example.com", Type: tt.recordType, Class: 1, TTL: 300, Data: tt.data,
+				})
+				return sent, err
+			})
+
+			msg, err := resolver.Resolve("example.com", tt.recordType)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if !bytes.Equal(msg.Raw, sent) {
+				t.Fatalf("Raw = %x, want the response as received %x", msg.Raw, sent)
+			}
+			if bytes.Contains(msg.Raw, []byte(tt.expanded)) {
+				t.Fatalf("response %x does not compress the record data", msg.Raw)
+			}
+			if len(msg.Answers) != 1 {
+				t.Fatalf("got %d answers, want 1", len(msg.Answers))
+			}
+			if got := msg.Answers[0].RDataString(msg.Raw); got != tt.want {
+				t.Errorf("RDataString(Raw) = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// EDNSOptionEDE is the EDNS option code of Extended DNS Errors (RFC 8914).
+const EDNSOptionEDE uint16 = 15
+
+// EDECode is an Extended DNS Error INFO-CODE, which explains why a server produced
+// the response it did, for example why it answered SERVFAIL.
+type EDECode uint16
+
+const (
+	EDEOther                       EDECode = 0  // EDEOther covers errors that fit no other code
+	EDEUnsupportedDNSKEYAlgorithm  EDECode = 1  // EDEUnsupportedDNSKEYAlgorithm indicates an unsupported DNSKEY algorithm
+	EDEUnsupportedDSDigestType     EDECode = 2  // EDEUnsupportedDSDigestType indicates an unsupported DS digest type
+	EDEStaleAnswer                 EDECode = 3  // EDEStaleAnswer indicates the answer was served from stale cache data
+	EDEForgedAnswer                EDECode = 4  // EDEForgedAnswer indicates the answer was forged by policy
+	EDEDNSSECIndeterminate         EDECode = 5  // EDEDNSSECIndeterminate indicates DNSSEC validation was indeterminate
+	EDEDNSSECBogus                 EDECode = 6  // EDEDNSSECBogus indicates DNSSEC validation failed
+	EDESignatureExpired            EDECode = 7  // EDESignatureExpired indicates only expired signatures were found
+	EDESignatureNotYetValid        EDECode = 8  // EDESignatureNotYetValid indicates only signatures not yet valid were found
+	EDEDNSKEYMissing               EDECode = 9  // EDEDNSKEYMissing indicates a DS record had no matching DNSKEY
+	EDERRSIGsMissing               EDECode = 10 // EDERRSIGsMissing indicates signatures were expected but missing
+	EDENoZoneKeyBitSet             EDECode = 11 // EDENoZoneKeyBitSet indicates no DNSKEY had the Zone Key bit set
+	EDENSECMissing                 EDECode = 12 // EDENSECMissing indicates a denial of existence lacked NSEC records
+	EDECachedError                 EDECode = 13 // EDECachedError indicates the error was served from cache
+	EDENotReady                    EDECode = 14 // EDENotReady indicates the server is not yet ready to serve
+	EDEBlocked                     EDECode = 15 // EDEBlocked indicates the domain is blocked by the operator
+	EDECensored                    EDECode = 16 // EDECensored indicates the domain is blocked due to an external requirement
+	EDEFiltered                    EDECode = 17 // EDEFiltered indicates the domain is blocked at the client's request
+	EDEProhibited                  EDECode = 18 // EDEProhibited indicates the client is not permitted to query
+	EDEStaleNXDOMAINAnswer         EDECode = 19 // EDEStaleNXDOMAINAnswer indicates a stale NXDOMAIN was served from cache
+	EDENotAuthoritative            EDECode = 20 // EDENotAuthoritative indicates an authoritative server was asked to recurse
+	EDENotSupported                EDECode = 21 // EDENotSupported indicates the requested operation is not supported
+	EDENoReachableAuthority        EDECode = 22 // EDENoReachableAuthority indicates no authoritative server could be reached
+	EDENetworkError                EDECode = 23 // EDENetworkError indicates an unrecoverable network error
+	EDEInvalidData                 EDECode = 24 // EDEInvalidData indicates the authoritative data is invalid
+	EDESignatureExpiredBeforeValid EDECode = 25 // EDESignatureExpiredBeforeValid indicates signatures expired before becoming valid
+	EDETooEarly                    EDECode = 26 // EDETooEarly indicates the query was received in 0-RTT data too early
+	EDEUnsupportedNSEC3Iterations  EDECode = 27 // EDEUnsupportedNSEC3Iterations indicates an NSEC3 iteration count above the limit
+	EDEUnableToConformToPolicy     EDECode = 28 // EDEUnableToConformToPolicy indicates a policy could not be applied
+	EDESynthesized                 EDECode = 29 // EDESynthesized indicates the answer was synthesized
+)
+
+// edeNames maps Extended DNS Error codes to the names used in the IANA registry.
+var edeNames = map[EDECode]string{
+	EDEOther:                       "Other",
+	EDEUnsupportedDNSKEYAlgorithm:  "Unsupported DNSKEY Algorithm",
+	EDEUnsupportedDSDigestType:     "Unsupported DS Digest Type",
+	EDEStaleAnswer:                 "Stale Answer",
+	EDEForgedAnswer:                "Forged Answer",
+	EDEDNSSECIndeterminate:         "DNSSEC Indeterminate",
+	EDEDNSSECBogus:                 "DNSSEC Bogus",
+	EDESignatureExpired:            "Signature Expired",
+	EDESignatureNotYetValid:        "Signature Not Yet Valid",
+	EDEDNSKEYMissing:               "DNSKEY Missing",
+	EDERRSIGsMissing:               "RRSIGs Missing",
+	EDENoZoneKeyBitSet:             "No Zone Key Bit Set",
+	EDENSECMissing:                 "NSEC Missing",
+	EDECachedError:                 "Cached Error",
+	EDENotReady:                    "Not Ready",
+	EDEBlocked:                     "Blocked",
+	EDECensored:                    "Censored",
+	EDEFiltered:                    "Filtered",
+	EDEProhibited:                  "Prohibited",
+	EDEStaleNXDOMAINAnswer:         "Stale NXDOMAIN Answer",
+	EDENotAuthoritative:            "Not Authoritative",
+	EDENotSupported:                "Not Supported",
+	EDENoReachableAuthority:        "No Reachable Authority",
+	EDENetworkError:                "Network Error",
+	EDEInvalidData:                 "Invalid Data",
+	EDESignatureExpiredBeforeValid: "Signature Expired before Valid",
+	EDETooEarly:                    "Too Early",
+	EDEUnsupportedNSEC3Iterations:  "Unsupported NSEC3 Iterations Value",
+	EDEUnableToConformToPolicy:     "Unable to conform to policy",
+	EDESynthesized:                 "Synthesized",
+}
+
+// String returns the registered name of the code, such as "DNSSEC Bogus".
+// Unassigned codes are formatted as "EDEn".
+func (c EDECode) String() string {
+	if name, ok := edeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("EDE%d", uint16(c))
+}
+
+// ExtendedError is a decoded Extended DNS Error option (RFC 8914). Servers attach
+// it to responses to explain a failure or a policy decision in more detail than
+// the response code allows.
+type ExtendedError struct {
+	InfoCode  EDECode // InfoCode identifies the kind of error
+	ExtraText string  // ExtraText is optional free-form text for human consumption
+}
+
+// String formats the error the way dig(1) prints it, e.g.
+// "6 (DNSSEC Bogus): (no valid signature found)".
+func (e ExtendedError) String() string {
+	s := fmt.Sprintf("%d (%s)", uint16(e.InfoCode), e.InfoCode)
+	if e.ExtraText != "" {
+		s += fmt.Sprintf(": (%s)", e.ExtraText)
+	}
+	return s
+}
+
+// ExtendedErrors decodes every Extended DNS Error option carried in the EDNS
+// options. Malformed options, which are shorter than the two-byte INFO-CODE, are
+// skipped.
+func (e *EDNS) ExtendedErrors() []ExtendedError {
+	var errs []ExtendedError
+	for _, option := range e.Options {
+		if option.Code != EDNSOptionEDE || len(option.Data) < 2 {
+			continue
+		}
+		errs = append(errs, ExtendedError{
+			InfoCode:  EDECode(binary.BigEndian.Uint16(option.Data[:2])),
+			ExtraText: strings.TrimRight(string(option.Data[2:]), "\x00"),
+		})
+	}
+	return errs
+}
+
+// ExtendedErrors returns the Extended DNS Errors attached to the message, or nil
+// if the message carries no EDNS information or no such options.
+func (m *DNSMessage) ExtendedErrors() []ExtendedError {
+	edns := m.EDNS()
+	if edns == nil {
+		return nil
+	}
+	return edns.ExtendedErrors()
+}
+
+// Option encodes the extended error as an EDNS option, ready to be added to
+// EDNS.Options when building a response.
+func (e ExtendedError) Option() EDNSOption {
+	data := make([]byte, 2+len(e.ExtraText))
+	binary.BigEndian.PutUint16(data[:2], uint16(e.InfoCode))
+	copy(data[2:], e.ExtraText)
+	return EDNSOption{Code: EDNSOptionEDE, Data: data}
+}
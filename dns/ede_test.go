@@ -0,0 +1,66 @@
+package dns
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtendedErrors(t *testing.T) {
+	edns := &EDNS{Options: []EDNSOption{
+		ExtendedError{InfoCode: EDEDNSSECBogus, ExtraText: "no valid signature found"}.Option(),
+		{Code: 10, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}, // a cookie, not an EDE
+		{Code: EDNSOptionEDE, Data: []byte{0}},           // malformed: no full INFO-CODE
+		{Code: EDNSOptionEDE, Data: []byte{0, 15}},       // no EXTRA-TEXT
+		{Code: EDNSOptionEDE, Data: []byte{0x01, 0x00, 'x', 0}},
+	}}
+	want := []ExtendedError{
+		{InfoCode: EDEDNSSECBogus, ExtraText: "no valid signature found"},
+		{InfoCode: EDEBlocked},
+		// Unassigned codes are kept, and trailing NULs are dropped from the text.
+		{InfoCode: 256, ExtraText: "x"},
+	}
+	if got := edns.ExtendedErrors(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtendedErrors() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMessageExtendedErrors(t *testing.T) {
+	msg := &DNSMessage{
+		Header:    Header{ID: 1, Flags: FlagQR | uint16(RcodeServerFailure)},
+		Questions: []Question{{Name: "example.com", Type: TypeA, Class: 1}},
+	}
+	if errs := msg.ExtendedErrors(); errs != nil {
+		t.Errorf("ExtendedErrors() without EDNS = %+v, want nil", errs)
+	}
+
+	msg.SetEDNS(&EDNS{Options: []EDNSOption{ExtendedError{InfoCode: EDEStaleAnswer}.Option()}})
+	packed, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	got, err := Unpack(packed)
+	if err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+	if errs := got.ExtendedErrors(); !reflect.DeepEqual(errs, []ExtendedError{{InfoCode: EDEStaleAnswer}}) {
+		t.Errorf("ExtendedErrors() = %+v, want a single Stale Answer", errs)
+	}
+}
+
+func TestExtendedErrorString(t *testing.T) {
+	tests := []struct {
+		value interface{ String() string }
+		want  string
+	}{
+		{value: ExtendedError{InfoCode: EDEDNSSECBogus, ExtraText: "no valid signature found"}, want: "6 (DNSSEC Bogus): (no valid signature found)"},
+		{value: ExtendedError{InfoCode: EDEBlocked}, want: "15 (Blocked)"},
+		{value: ExtendedError{InfoCode: 500}, want: "500 (EDE500)"},
+		{value: ExtendedError{InfoCode: EDENetworkError}.Option(), want: "EDE=23 (Network Error)"},
+		{value: EDNSOption{Code: EDNSOptionEDE, Data: []byte{7}}, want: "OPT15=07"},
+	}
+	for _, tt := range tests {
+		if got := tt.value.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// EDNSFlagDO is the "DNSSEC OK" bit of the EDNS flags field (RFC 3225). Setting it
+// in a query asks the server to include DNSSEC records in the response.
+const EDNSFlagDO uint16 = 0x8000
+
+// DefaultEDNSUDPSize is the UDP payload size advertised when EDNS.UDPSize is zero.
+// 1232 bytes avoids IP fragmentation on virtually all paths, as recommended by
+// the DNS Flag Day 2020 initiative.
+const DefaultEDNSUDPSize = 1232
+
+// EDNS describes the Extension Mechanisms for DNS (EDNS(0), RFC 6891) carried in
+// the OPT pseudo-record of a message's additional section.
+//
+// On a Resolver, EDNS configures the OPT record appended to every query. On a
+// response, it is obtained with DNSMessage.EDNS and exposes what the server
+// advertised, including the upper bits of the extended response code.
+//
+// Example:
+//
+//	resolver := dns.NewResolver("1.1.1.1:53")
+//	resolver.EDNS = &dns.EDNS{UDPSize: 1232, Flags: dns.EDNSFlagDO}
+type EDNS struct {
+	// UDPSize is the largest UDP payload the sender can reassemble. Values below 512
+	// are treated as 512; zero in a Resolver configuration means DefaultEDNSUDPSize.
+	UDPSize uint16
+
+	// ExtendedRcode holds the upper eight bits of the 12-bit response code. It is
+	// combined with the four RCODE bits of the header to form the full code.
+	ExtendedRcode uint8
+
+	// Version is the EDNS version; only version 0 is currently defined.
+	Version uint8
+
+	// Flags holds the EDNS flags field, such as EDNSFlagDO.
+	Flags uint16
+
+	// Options holds the EDNS options carried in the OPT record's data.
+	Options []EDNSOption
+}
+
+// DO reports whether the "DNSSEC OK" bit is set.
+func (e *EDNS) DO() bool {
+	return e.Flags&EDNSFlagDO != 0
+}
+
+// payloadSize returns the UDP payload size to advertise and to size receive buffers
+// with, applying the default and the RFC 6891 floor of 512 bytes.
+func (e *EDNS) payloadSize() int {
+	if e.UDPSize == 0 {
+		return DefaultEDNSUDPSize
+	}
+	return max(int(e.UDPSize), 512)
+}
+
+// record builds the OPT pseudo-record that carries e. The requestor's payload size
+// travels in the CLASS field and the extended RCODE, version and flags in the TTL
+// field, as laid out in RFC 6891 section 6.1.3.
+func (e *EDNS) record() ResourceRecord {
+	return ResourceRecord{
+		Name:  "",
+		Type:  TypeOPT,
+		Class: uint16(e.payloadSize()),
+		TTL:   uint32(e.ExtendedRcode)<<24 | uint32(e.Version)<<16 | uint32(e.Flags),
+		Data:  &OPT{Options: e.Options},
+	}
+}
+
+// EDNS returns the EDNS information carried by the message's OPT pseudo-record, or
+// nil if the message has none. The OPT record is looked up in the additional
+// section, where RFC 6891 requires it to appear.
+func (m *DNSMessage) EDNS() *EDNS {
+	for i := range m.Additional {
+		rr := &m.Additional[i]
+		if rr.Type != TypeOPT {
+			continue
+		}
+		e := &EDNS{
+			UDPSize:       rr.Class,
+			ExtendedRcode: uint8(rr.TTL >> 24),
+			Version:       uint8(rr.TTL >> 16),
+			Flags:         uint16(rr.TTL),
+		}
+		if opt, ok := rr.Data.(*OPT); ok {
+			e.Options = opt.Options
+		}
+		return e
+	}
+	return nil
+}
+
+// SetEDNS adds an OPT pseudo-record describing e to the additional section,
+// replacing any OPT record already present. Passing nil removes the OPT record.
+func (m *DNSMessage) SetEDNS(e *EDNS) {
+	additional := m.Additional[:0:0]
+	for _, rr := range m.Additional {
+		if rr.Type != TypeOPT {
+			additional = append(additional, rr)
+		}
+	}
+	if e != nil {
+		additional = append(additional, e.record())
+	}
+	m.Additional = additional
+}
+
+// EDNSOption is a single option carried in an OPT pseudo-record, identified by its
+// option code (RFC 6891 section 6.1.2). The option data is kept uninterpreted.
+type EDNSOption struct {
+	Code uint16 // Code identifies the option, as assigned by IANA
+	Data []byte // Data is the option's payload
+}
+
+// String returns the option code followed by its data in hexadecimal. Extended
+// DNS Error options are shown in decoded form.
+func (o EDNSOption) String() string {
+	if o.Code == EDNSOptionEDE && len(o.Data) >= 2 {
+		ede := (&EDNS{Options: []EDNSOption{o}}).ExtendedErrors()
+		return fmt.Sprintf("EDE=%s", ede[0])
+	}
+	return fmt.Sprintf("OPT%d=%x", o.Code, o.Data)
+}
+
+// OPT holds the data of an OPT pseudo-record: the list of EDNS options. The other
+// EDNS fields are encoded in the record's CLASS and TTL and are best accessed
+// through DNSMessage.EDNS.
+type OPT struct {
+	Options []EDNSOption // Options holds each option in wire order
+}
+
+// String returns the options separated by spaces.
+func (o *OPT) String() string {
+	options := make([]string, len(o.Options))
+	for i, option := range o.Options {
+		options[i] = option.String()
+	}
+	return strings.Join(options, " ")
+}
+
+func (o *OPT) pack(buf *bytes.Buffer, compression map[string]int) error {
+	for _, option := range o.Options {
+		if len(option.Data) > 0xFFFF {
+			return fmt.Errorf("EDNS option %d data of %d bytes is too long", option.Code, len(option.Data))
+		}
+		binary.Write(buf, binary.BigEndian, option.Code)
+		binary.Write(buf, binary.BigEndian, uint16(len(option.Data)))
+		buf.Write(option.Data)
+	}
+	return nil
+}
+
+// unpackOPT decodes the option list of an OPT record's RDATA.
+func unpackOPT(rdata []byte) (*OPT, error) {
+	opt := &OPT{}
+	for len(rdata) > 0 {
+		if len(rdata) < 4 {
+			return nil, fmt.Errorf("EDNS option header truncated")
+		}
+		code := binary.BigEndian.Uint16(rdata[0:2])
+		length := int(binary.BigEndian.Uint16(rdata[2:4]))
+		if 4+length > len(rdata) {
+			return nil, fmt.Errorf("EDNS option %d length %d exceeds record data", code, length)
+		}
+		data := make([]byte, length)
+		copy(data, rdata[4:4+length])
+		opt.Options = append(opt.Options, EDNSOption{Code: code, Data: data})
+		rdata = rdata[4+length:]
+	}
+	return opt, nil
+}
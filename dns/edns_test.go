@@ -0,0 +1,132 @@
+package dns
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildQueryEDNS(t *testing.T) {
+	tests := []struct {
+		name      string
+		edns      *EDNS
+		wantClass uint16
+		wantTTL   uint32
+	}{
+		{name: "default size", edns: &EDNS{}, wantClass: DefaultEDNSUDPSize},
+		{name: "clamped to 512", edns: &EDNS{UDPSize: 100}, wantClass: 512},
+		{name: "large size", edns: &EDNS{UDPSize: 4096}, wantClass: 4096},
+		{name: "DO bit", edns: &EDNS{UDPSize: 1232, Flags: EDNSFlagDO}, wantClass: 1232, wantTTL: 0x00008000},
+		{name: "version", edns: &EDNS{UDPSize: 1232, Version: 1}, wantClass: 1232, wantTTL: 0x00010000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := NewResolver("")
+			resolver.EDNS = tt.edns
+			query, _, err := resolver.buildQuery("example.com", TypeA)
+			if err != nil {
+				t.Fatalf("buildQuery() error = %v", err)
+			}
+			msg, err := Unpack(query)
+			if err != nil {
+				t.Fatalf("Unpack() error = %v", err)
+			}
+			if msg.Header.ARCOUNT != 1 || len(msg.Additional) != 1 {
+				t.Fatalf("ARCOUNT = %d with %d additional records, want a single OPT record",
+					msg.Header.ARCOUNT, len(msg.Additional))
+			}
+
+			opt := msg.Additional[0]
+			if opt.Name != "" || opt.Type != TypeOPT {
+				t.Errorf("additional record is %q %s, want the root name and OPT", opt.Name, opt.Type)
+			}
+			if opt.Class != tt.wantClass || opt.TTL != tt.wantTTL {
+				t.Errorf("OPT CLASS = %d, TTL = %#08x, want %d, %#08x", opt.Class, opt.TTL, tt.wantClass, tt.wantTTL)
+			}
+			if got := resolver.EDNS.payloadSize(); got != int(tt.wantClass) {
+				t.Errorf("payloadSize() = %d, want %d", got, tt.wantClass)
+			}
+			if edns := msg.EDNS(); edns.DO() != (tt.edns.Flags&EDNSFlagDO != 0) {
+				t.Errorf("DO() = %t on a query built with flags %#04x", edns.DO(), tt.edns.Flags)
+			}
+		})
+	}
+}
+
+func TestBuildQueryWithoutEDNS(t *testing.T) {
+	query, _, err := NewResolver("").buildQuery("example.com", TypeA)
+	if err != nil {
+		t.Fatalf("buildQuery() error = %v", err)
+	}
+	msg, err := Unpack(query)
+	if err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+	if msg.Header.ARCOUNT != 0 || msg.EDNS() != nil {
+		t.Errorf("query without EDNS has ARCOUNT %d and EDNS %+v", msg.Header.ARCOUNT, msg.EDNS())
+	}
+}
+
+func TestMessageEDNS(t *testing.T) {
+	// A BADVERS response: RCODE 16 is split between the header, which carries
+	// zero, and the OPT record, which carries the upper bits as 1.
+	options := []EDNSOption{{Code: 10, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}}
+	msg := &DNSMessage{
+		Header:    Header{ID: 1, Flags: FlagQR},
+		Questions: []Question{{Name: "example.com", Type: TypeA, Class: 1}},
+	}
+	msg.SetEDNS(&EDNS{UDPSize: 4096, ExtendedRcode: 1, Version: 0, Flags: EDNSFlagDO, Options: options})
+	packed, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	got, err := Unpack(packed)
+	if err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+
+	edns := got.EDNS()
+	if edns == nil {
+		t.Fatal("EDNS() = nil, want the OPT record's contents")
+	}
+	if edns.UDPSize != 4096 || edns.ExtendedRcode != 1 || edns.Version != 0 || !edns.DO() {
+		t.Errorf("EDNS() = %+v, want UDP size 4096, extended RCODE 1, version 0 and DO", edns)
+	}
+	if !reflect.DeepEqual(edns.Options, options) {
+		t.Errorf("Options = %v, want %v", edns.Options, options)
+	}
+	if rcode := got.Rcode(); rcode != RcodeBadVersion {
+		t.Errorf("Rcode() = %s, want BADVERS", rcode)
+	}
+
+	// SetEDNS replaces the OPT record rather than adding a second one, and nil
+	// removes it.
+	got.SetEDNS(&EDNS{Version: 1})
+	if len(got.Additional) != 1 || got.EDNS().Version != 1 {
+		t.Errorf("after SetEDNS the additional section is %v, want one OPT record of version 1",
+			formatRecords(got.Additional))
+	}
+	got.SetEDNS(nil)
+	if got.EDNS() != nil || len(got.Additional) != 0 {
+		t.Errorf("SetEDNS(nil) left %v", formatRecords(got.Additional))
+	}
+}
+
+func TestUnpackOPTRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		rdata   []byte
+		wantErr string
+	}{
+		{name: "truncated header", rdata: []byte{0, 15, 0}, wantErr: "header truncated"},
+		{name: "data past end", rdata: []byte{0, 15, 0, 4, 0, 6}, wantErr: "exceeds record data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := unpackOPT(tt.rdata)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("unpackOPT() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HTTPSScheme is the prefix that selects DNS-over-HTTPS for an upstream server
+// address. The whole address is the URL of the DoH endpoint, as in
+// "https://dns.google/dns-query".
+const HTTPSScheme = "https://"
+
+// DoHMediaType is the media type of DNS wire-format messages exchanged over
+// DNS-over-HTTPS (RFC 8484 section 6).
+const DoHMediaType = "application/dns-message"
+
+// HTTPSTransport sends queries over DNS-over-HTTPS (RFC 8484). Each query is sent
+// in wire format to the endpoint URL, either as the body of a POST request or
+// base64url-encoded in the "dns" parameter of a GET request.
+//
+// As RFC 8484 section 4.1 recommends, queries are sent with an ID of 0 so that
+// identical queries produce identical, HTTP-cacheable requests; the caller's ID is
+// restored in the response. When the response carries HTTP freshness information,
+// record TTLs are clamped so that they do not outlive it (section 5.1).
+//
+// Connection reuse, including HTTP/2 multiplexing, is provided by the HTTP client:
+// the default client keeps connections alive and negotiates HTTP/2 with servers
+// that support it.
+//
+// A Resolver uses its HTTPSTransport for every upstream whose address starts with
+// HTTPSScheme:
+//
+//	resolver := dns.NewResolver("https://cloudflare-dns.com/dns-query")
+//	resolver.HTTPSTransport = &dns.HTTPSTransport{Method: http.MethodGet}
+type HTTPSTransport struct {
+	// Client is the HTTP client used to send requests. When nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+
+	// Method is the HTTP method used for queries, http.MethodPost or
+	// http.MethodGet. When empty, POST is used.
+	Method string
+}
+
+// Exchange sends query to the DoH endpoint at url and returns the response
+// message. Responses that are not 200 OK or are not of DoHMediaType are
+// reported as errors.
+func (t *HTTPSTransport) Exchange(ctx context.Context, url string, query []byte) ([]byte, error) {
+	if len(query) < 12 {
+		return nil, fmt.Errorf("query of %d bytes is too short", len(query))
+	}
+	id := binary.BigEndian.Uint16(query)
+	wire := bytes.Clone(query)
+	binary.BigEndian.PutUint16(wire, 0)
+
+	req, err := t.newRequest(ctx, url, wire)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build HTTP request: %w", err)
+	}
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send query: %w", contextError(ctx, err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server returned HTTP status %s", resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != DoHMediaType {
+		return nil, fmt.Errorf("DoH server returned unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	response, err := io.ReadAll(io.LimitReader(resp.Body, 0xFFFF+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", contextError(ctx, err))
+	}
+	if len(response) > 0xFFFF {
+		return nil, fmt.Errorf("DoH response exceeds maximum DNS message size")
+	}
+	if len(response) < 12 {
+		return nil, fmt.Errorf("DoH response of %d bytes is too short", len(response))
+	}
+
+	binary.BigEndian.PutUint16(response, id)
+	if lifetime, ok := freshnessLifetime(resp.Header); ok {
+		if err := clampTTLs(response, lifetime); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+	return response, nil
+}
+
+// newRequest builds the HTTP request carrying a wire-format query.
+func (t *HTTPSTransport) newRequest(ctx context.Context, url string, query []byte) (*http.Request, error) {
+	var req *http.Request
+	var err error
+	switch t.Method {
+	case "", http.MethodPost:
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(query))
+		if err == nil {
+			req.Header.Set("Content-Type", DoHMediaType)
+		}
+	case http.MethodGet:
+		separator := "?"
+		if strings.Contains(url, "?") {
+			separator = "&"
+		}
+		url += separator + "dns=" + base64.RawURLEncoding.EncodeToString(query)
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	default:
+		return nil, fmt.Errorf("unsupported DoH method %q", t.Method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", DoHMediaType)
+	return req, nil
+}
+
+// freshnessLifetime returns the remaining HTTP freshness lifetime of a response in
+// seconds: the Cache-Control max-age directive less the Age header. It reports
+// false when the response does not specify a max-age.
+func freshnessLifetime(header http.Header) (uint32, bool) {
+	maxAge := int64(-1)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if !strings.EqualFold(name, "max-age") {
+				continue
+			}
+			if seconds, err := strconv.ParseInt(strings.Trim(arg, `"`), 10, 64); err == nil && seconds >= 0 {
+				maxAge = seconds
+			}
+		}
+	}
+	if maxAge < 0 {
+		return 0, false
+	}
+
+	if age, err := strconv.ParseInt(header.Get("Age"), 10, 64); err == nil && age > 0 {
+		maxAge = max(maxAge-age, 0)
+	}
+	return uint32(min(maxAge, int64(^uint32(0)))), true
+}
+
+// clampTTLs lowers the TTL of every record in a wire-format message to at most
+// limit seconds. The message is modified in place; the OPT pseudo-record is left
+// alone because its TTL field carries EDNS flags.
+func clampTTLs(message []byte, limit uint32) error {
+	header, err := UnpackHeader(message)
+	if err != nil {
+		return err
+	}
+
+	offset := 12
+	for i := 0; i < int(header.QDCOUNT); i++ {
+		_, questionLength, err := parseQuestion(message, offset)
+		if err != nil {
+			return err
+		}
+		offset += questionLength
+	}
+
+	records := int(header.ANCOUNT) + int(header.NSCOUNT) + int(header.ARCOUNT)
+	for i := 0; i < records; i++ {
+		_, nameLength, err := DecodeDomainName(message, offset)
+		if err != nil {
+			return err
+		}
+		offset += nameLength
+		if offset+10 > len(message) {
+			return fmt.Errorf("resource record truncated")
+		}
+		recordType := RecordType(binary.BigEndian.Uint16(message[offset : offset+2]))
+		ttl := binary.BigEndian.Uint32(message[offset+4 : offset+8])
+		if recordType != TypeOPT && ttl > limit {
+			binary.BigEndian.PutUint32(message[offset+4:offset+8], limit)
+		}
+		offset += 10 + int(binary.BigEndian.Uint16(message[offset+8:offset+10]))
+		if offset > len(message) {
+			return fmt.Errorf("resource record data truncated")
+		}
+	}
+	return nil
+}
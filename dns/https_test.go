@@ -0,0 +1,93 @@
+package dns
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSTransport(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		wantTTL []uint32
+	}{
+		{name: "POST", method: http.MethodPost, wantTTL: []uint32{300, 30}},
+		{name: "GET", method: http.MethodGet, wantTTL: []uint32{300, 30}},
+		{
+			name:    "max-age less Age",
+			method:  http.MethodPost,
+			headers: map[string]string{"Cache-Control": "public, max-age=100", "Age": "40"},
+			wantTTL: []uint32{60, 30},
+		},
+		{
+			name:    "Age beyond max-age",
+			method:  http.MethodGet,
+			headers: map[string]string{"Cache-Control": "max-age=100", "Age": "250"},
+			wantTTL: []uint32{0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				var query []byte
+				var err error
+				switch req.Method {
+				case http.MethodPost:
+					if got := req.Header.Get("Content-Type"); got != DoHMediaType {
+						t.Errorf("Content-Type = %q, want %q", got, DoHMediaType)
+					}
+					query, err = io.ReadAll(req.Body)
+				case http.MethodGet:
+					query, err = base64.RawURLEncoding.DecodeString(req.URL.Query().Get("dns"))
+				}
+				if err != nil || len(query) < 12 {
+					http.Error(w, "bad query", http.StatusBadRequest)
+					return
+				}
+				if req.Method != tt.method {
+					t.Errorf("request method = %s, want %s", req.Method, tt.method)
+				}
+				if id := binary.BigEndian.Uint16(query); id != 0 {
+					t.Errorf("query sent with ID %d, want 0", id)
+				}
+
+				for name, value := range tt.headers {
+					w.Header().Set(name, value)
+				}
+				w.Header().Set("Content-Type", DoHMediaType)
+				response, err := answer(query, RcodeSuccess, *aRecord("192.0.2.1", 300), *aRecord("192.0.2.2", 30))
+				if err != nil {
+					t.Error(err)
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.Write(response)
+			}))
+			defer server.Close()
+
+			resolver := NewResolver(server.URL + "/dns-query")
+			resolver.HTTPSTransport = &HTTPSTransport{Client: server.Client(), Method: tt.method}
+			msg, err := resolver.Resolve("example.com", TypeA)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+
+			if id := binary.BigEndian.Uint16(msg.Raw); id != msg.Header.ID {
+				t.Errorf("response ID %d was not restored to the query ID %d", id, msg.Header.ID)
+			}
+			if len(msg.Answers) != len(tt.wantTTL) {
+				t.Fatalf("got %d answers, want %d", len(msg.Answers), len(tt.wantTTL))
+			}
+			for i, rr := range msg.Answers {
+				if rr.TTL != tt.wantTTL[i] {
+					t.Errorf("answer %d TTL = %d, want %d", i, rr.TTL, tt.wantTTL[i])
+				}
+			}
+		})
+	}
+}
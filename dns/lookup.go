@@ -0,0 +1,186 @@
+package dns
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ReverseName returns the name under which PTR records for addr are published:
+// the reversed dotted-decimal octets under in-addr.arpa for IPv4 (RFC 1035
+// section 3.5), and the reversed hexadecimal nibbles under ip6.arpa for IPv6
+// (RFC 3596 section 2.5). IPv4-mapped IPv6 addresses are treated as IPv4.
+//
+// Example:
+//
+//	dns.ReverseName(netip.MustParseAddr("192.0.2.1"))
+//	// "1.2.0.192.in-addr.arpa"
+//	dns.ReverseName(netip.MustParseAddr("2001:db8::1"))
+//	// "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa"
+func ReverseName(addr netip.Addr) (string, error) {
+	if !addr.IsValid() {
+		return "", fmt.Errorf("invalid IP address")
+	}
+
+	addr = addr.Unmap()
+	if addr.Is4() {
+		ip := addr.As4()
+		labels := make([]string, 0, len(ip)+2)
+		for i := len(ip) - 1; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(ip[i])))
+		}
+		return strings.Join(append(labels, "in-addr", "arpa"), "."), nil
+	}
+
+	const hexDigits = "0123456789abcdef"
+	ip := addr.As16()
+	var name strings.Builder
+	for i := len(ip) - 1; i >= 0; i-- {
+		name.WriteByte(hexDigits[ip[i]&0x0F])
+		name.WriteByte('.')
+		name.WriteByte(hexDigits[ip[i]>>4])
+		name.WriteByte('.')
+	}
+	name.WriteString("ip6.arpa")
+	return name.String(), nil
+}
+
+// LookupAddr performs a reverse lookup for addr and returns the host names its
+// PTR records point to. The result is empty if the reverse name exists but has
+// no PTR records; a reverse name that does not exist is reported as
+// ErrNameNotFound.
+//
+// LookupAddr is equivalent to LookupAddrContext with context.Background.
+//
+// Example:
+//
+//	names, err := resolver.LookupAddr(netip.MustParseAddr("8.8.8.8"))
+//	// names: ["dns.google"]
+func (r *Resolver) LookupAddr(addr netip.Addr) ([]string, error) {
+	return r.LookupAddrContext(context.Background(), addr)
+}
+
+// LookupAddrContext is like LookupAddr but uses the provided context to cancel
+// the lookup or bound it by a deadline.
+func (r *Resolver) LookupAddrContext(ctx context.Context, addr netip.Addr) ([]string, error) {
+	name, err := ReverseName(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := r.ResolveContext(ctx, name, TypePTR)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, rr := range msg.Answers {
+		if ptr, ok := rr.Data.(*PTR); ok {
+			hosts = append(hosts, ptr.Host)
+		}
+	}
+	return hosts, nil
+}
+
+// LookupSRV queries the SRV records of _service._proto.name, as described in
+// RFC 2782, and returns them in the order the targets should be tried: by
+// ascending priority, with targets of equal priority shuffled at random in
+// proportion to their weights. If service and proto are both empty, name is
+// queried directly. The randomness comes from the resolver's Rand when set.
+//
+// A single record whose target is the root name means the service is
+// decidedly not available at name; it is returned like any other record.
+//
+// LookupSRV is equivalent to LookupSRVContext with context.Background.
+//
+// Example:
+//
+//	srvs, err := resolver.LookupSRV("sip", "tcp", "example.com")
+//	// queries _sip._tcp.example.com
+//	for _, srv := range srvs {
+//		fmt.Println(srv.Target, srv.Port)
+//	}
+func (r *Resolver) LookupSRV(service, proto, name string) ([]*SRV, error) {
+	return r.LookupSRVContext(context.Background(), service, proto, name)
+}
+
+// LookupSRVContext is like LookupSRV but uses the provided context to cancel
+// the lookup or bound it by a deadline.
+func (r *Resolver) LookupSRVContext(ctx context.Context, service, proto, name string) ([]*SRV, error) {
+	target := name
+	if service != "" || proto != "" {
+		target = "_" + service + "._" + proto + "." + name
+	}
+
+	msg, err := r.ResolveContext(ctx, target, TypeSRV)
+	if err != nil {
+		return nil, err
+	}
+
+	var srvs []*SRV
+	for _, rr := range msg.Answers {
+		if srv, ok := rr.Data.(*SRV); ok {
+			srvs = append(srvs, srv)
+		}
+	}
+
+	r.randMu.Lock()
+	defer r.randMu.Unlock()
+	orderSRV(srvs, r.Rand)
+	return srvs, nil
+}
+
+// orderSRV sorts srvs into the order targets should be contacted, using the
+// selection algorithm of RFC 2782: records are grouped by ascending priority,
+// and within each group a running sum of the weights is compared against a
+// random number between zero and the group's total weight to pick each next
+// record. Records of weight zero are placed first before every pick, so they
+// are selected only rarely while heavier records remain. When rng is nil, the
+// package-level generator of math/rand/v2 is used.
+func orderSRV(srvs []*SRV, rng *rand.Rand) {
+	intN := rand.IntN
+	if rng != nil {
+		intN = rng.IntN
+	}
+
+	slices.SortStableFunc(srvs, func(a, b *SRV) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+
+	for start := 0; start < len(srvs); {
+		end := start + 1
+		for end < len(srvs) && srvs[end].Priority == srvs[start].Priority {
+			end++
+		}
+
+		group := srvs[start:end]
+		for i := range group {
+			remaining := group[i:]
+			slices.SortStableFunc(remaining, func(a, b *SRV) int {
+				return cmp.Compare(min(a.Weight, 1), min(b.Weight, 1))
+			})
+
+			total := 0
+			for _, srv := range remaining {
+				total += int(srv.Weight)
+			}
+			pick := intN(total + 1)
+
+			sum := 0
+			for j, srv := range remaining {
+				sum += int(srv.Weight)
+				if sum >= pick {
+					copy(remaining[1:j+1], remaining[:j])
+					remaining[0] = srv
+					break
+				}
+			}
+		}
+		start = end
+	}
+}
@@ -0,0 +1,183 @@
+package dns
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestReverseName(t *testing.T) {
+	tests := []struct {
+		addr    netip.Addr
+		want    string
+		wantErr bool
+	}{
+		{addr: netip.MustParseAddr("192.0.2.1"), want: "1.2.0.192.in-addr.arpa"},
+		{addr: netip.MustParseAddr("8.8.8.8"), want: "8.8.8.8.in-addr.arpa"},
+		{addr: netip.MustParseAddr("10.0.0.255"), want: "255.0.0.10.in-addr.arpa"},
+		{addr: netip.MustParseAddr("::ffff:192.0.2.1"), want: "1.2.0.192.in-addr.arpa"},
+		{
+			addr: netip.MustParseAddr("2001:db8::567:89ab"),
+			want: "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa",
+		},
+		{
+			addr: netip.MustParseAddr("::1"),
+			want: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa",
+		},
+		{
+			// The zone is not part of the reverse name.
+			addr: netip.MustParseAddr("fe80::1%eth0"),
+			want: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.e.f.ip6.arpa",
+		},
+		{addr: netip.Addr{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ReverseName(tt.addr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ReverseName(%v) = %q, want an error", tt.addr, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ReverseName(%v) = %q, %v, want %q", tt.addr, got, err, tt.want)
+		}
+	}
+}
+
+func TestLookupAddr(t *testing.T) {
+	// A classless delegation (RFC 2317): the reverse name is an alias for a
+	// name in the customer's zone, which holds the PTR records.
+	const alias = "1.0/25.2.0.192.in-addr.arpa"
+	resolver := NewResolver("fake")
+	resolver.Transport = transportFunc(func(ctx context.Context, server string, query []byte) ([]byte, error) {
+		question, _, err := parseQuestion(query, 12)
+		if err != nil {
+			return nil, err
+		}
+		if question.Name != "1.2.0.192.in-addr.arpa" || question.Type != TypePTR {
+			t.Errorf("queried %s %s, want 1.2.0.192.in-addr.arpa PTR", question.Name, question.Type)
+		}
+		return answer(query, RcodeSuccess,
+			ResourceRecord{Name: question.Name, Type: TypeCNAME, Class: 1, TTL: 300, Data: &CNAME{Target: alias}},
+			ResourceRecord{Name: alias, Type: TypePTR, Class: 1, TTL: 300, Data: &PTR{Host: "host.example.com."}},
+			ResourceRecord{Name: alias, Type: TypePTR, Class: 1, TTL: 300, Data: &PTR{Host: "www.example.com"}},
+		)
+	})
+
+	hosts, err := resolver.LookupAddr(netip.MustParseAddr("192.0.2.1"))
+	if err != nil {
+		t.Fatalf("LookupAddr() error = %v", err)
+	}
+	// Host names are returned without a trailing dot, whether or not the
+	// record was built with one.
+	if want := []string{"host.example.com", "www.example.com"}; !slices.Equal(hosts, want) {
+		t.Errorf("LookupAddr() = %q, want %q", hosts, want)
+	}
+
+	if _, err := resolver.LookupAddr(netip.Addr{}); err == nil {
+		t.Error("LookupAddr() of the zero Addr succeeded")
+	}
+}
+
+// srvTargets returns the targets of srvs in order.
+func srvTargets(srvs []*SRV) []string {
+	targets := make([]string, len(srvs))
+	for i, srv := range srvs {
+		targets[i] = srv.Target
+	}
+	return targets
+}
+
+// testSRVs returns two priority groups: three weighted targets at priority 10,
+// one of them with weight zero, and a single backup at priority 20.
+func testSRVs() []*SRV {
+	return []*SRV{
+		{Priority: 20, Weight: 5, Port: 5060, Target: "backup.example.com"},
+		{Priority: 10, Weight: 0, Port: 5060, Target: "zero.example.com"},
+		{Priority: 10, Weight: 30, Port: 5060, Target: "light.example.com"},
+		{Priority: 10, Weight: 70, Port: 5060, Target: "heavy.example.com"},
+	}
+}
+
+func TestOrderSRVSeeded(t *testing.T) {
+	first := testSRVs()
+	orderSRV(first, rand.New(rand.NewPCG(1, 2)))
+	second := testSRVs()
+	orderSRV(second, rand.New(rand.NewPCG(1, 2)))
+
+	if !slices.Equal(srvTargets(first), srvTargets(second)) {
+		t.Errorf("orders differ with the same seed: %v and %v", srvTargets(first), srvTargets(second))
+	}
+	for i := 1; i < len(first); i++ {
+		if first[i].Priority < first[i-1].Priority {
+			t.Fatalf("order %v is not by ascending priority", srvTargets(first))
+		}
+	}
+	if last := first[len(first)-1].Target; last != "backup.example.com" {
+		t.Errorf("last target = %s, want the priority 20 backup", last)
+	}
+}
+
+func TestOrderSRVWeights(t *testing.T) {
+	rng := rand.New(rand.NewPCG(42, 42))
+	const trials = 10000
+	firsts := make(map[string]int)
+	for range trials {
+		srvs := testSRVs()
+		orderSRV(srvs, rng)
+		firsts[srvs[0].Target]++
+	}
+
+	// RFC 2782 selects the first target with probability proportional to its
+	// weight; the zero-weight target is chosen only when the draw is zero.
+	tests := []struct {
+		target   string
+		min, max int
+	}{
+		{target: "heavy.example.com", min: 6600, max: 7200},
+		{target: "light.example.com", min: 2700, max: 3300},
+		{target: "zero.example.com", min: 0, max: 300},
+		{target: "backup.example.com", min: 0, max: 0},
+	}
+	for _, tt := range tests {
+		if got := firsts[tt.target]; got < tt.min || got > tt.max {
+			t.Errorf("%s chosen first %d times out of %d, want between %d and %d",
+				tt.target, got, trials, tt.min, tt.max)
+		}
+	}
+}
+
+func TestLookupSRV(t *testing.T) {
+	resolver := NewResolver("fake")
+	resolver.Rand = rand.New(rand.NewPCG(7, 7))
+	resolver.Transport = transportFunc(func(ctx context.Context, server string, query []byte) ([]byte, error) {
+		question, _, err := parseQuestion(query, 12)
+		if err != nil {
+			return nil, err
+		}
+		if question.Name != "_sip._tcp.example.com" || question.Type != TypeSRV {
+			t.Errorf("queried %s %s, want _sip._tcp.example.com SRV", question.Name, question.Type)
+		}
+		var answers []ResourceRecord
+		for _, srv := range testSRVs() {
+			answers = append(answers, ResourceRecord{
+				Name: question.Name, Type: TypeSRV, Class: 1, TTL: 300, Data: srv,
+			})
+		}
+		return answer(query, RcodeSuccess, answers...)
+	})
+
+	srvs, err := resolver.LookupSRV("sip", "tcp", "example.com")
+	if err != nil {
+		t.Fatalf("LookupSRV() error = %v", err)
+	}
+
+	want := testSRVs()
+	orderSRV(want, rand.New(rand.NewPCG(7, 7)))
+	if got := srvTargets(srvs); !slices.Equal(got, srvTargets(want)) {
+		t.Errorf("LookupSRV() targets = %v, want %v", got, srvTargets(want))
+	}
+}
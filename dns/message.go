@@ -9,13 +9,173 @@ import (
 
 // DNSMessage represents a complete DNS message containing header, questions, and answer sections.
 // It follows RFC 1035 specification for DNS message format and provides methods for
-// encoding and decoding DNS messages over UDP transport.
+// encoding and decoding DNS messages. Pack and Unpack are exact inverses, so the same
+// type can be used to build responses, proxies and test fixtures.
 type DNSMessage struct {
 	Header     Header           // Header contains control information and section counts
 	Questions  []Question       // Questions contains queries being asked
 	Answers    []ResourceRecord // Answers contains resource records that answer the questions
 	Authority  []ResourceRecord // Authority contains resource records from authoritative servers
 	Additional []ResourceRecord // Additional contains supplementary resource records
+
+	// Raw holds the wire-format message exactly as received from the server. It is
+	// populated by the Resolver and is nil for messages built or unpacked directly.
+	// When concurrent callers share one upstream exchange, each receives its own
+	// copy of Raw with the ID rewritten to match its query. Answers served from the
+	// Cache have a nil Raw, since their counted-down TTLs no longer match any
+	// message that was received.
+	Raw []byte
+
+	// Server is the address of the upstream that produced this response. It is
+	// populated by the Resolver, which makes it possible to tell which server won
+	// when querying several upstreams, and is empty otherwise.
+	Server string
+}
+
+// Pack serializes the complete DNSMessage into DNS wire format, including the
+// question, answer, authority and additional sections. Domain names are compressed
+// as described in RFC 1035 section 4.1.4: owner names, question names and the names
+// embedded in the RDATA of well-known record types are replaced with pointers to
+// earlier occurrences wherever possible.
+//
+// The section counts written to the header are derived from the lengths of the
+// section slices, and each record's RDLENGTH is computed from its packed RDATA,
+// so callers do not need to keep those fields consistent by hand.
+//
+// Example:
+//
+//	msg := &DNSMessage{
+//		Header:    Header{ID: 0x1234, Flags: FlagQR | FlagRD | FlagRA},
+//		Questions: []Question{{Name: "example.com", Type: TypeA, Class: 1}},
+//	}
+//	wire, err := msg.Pack()
+func (m *DNSMessage) Pack() ([]byte, error) {
+	header := m.Header
+	header.QDCOUNT = uint16(len(m.Questions))
+	header.ANCOUNT = uint16(len(m.Answers))
+	header.NSCOUNT = uint16(len(m.Authority))
+	header.ARCOUNT = uint16(len(m.Additional))
+
+	headerBytes, err := header.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(headerBytes)
+	compression := make(map[string]int)
+
+	for i, q := range m.Questions {
+		if err := packDomainName(buf, q.Name, compression); err != nil {
+			return nil, fmt.Errorf("failed to pack question %d: %w", i, err)
+		}
+		binary.Write(buf, binary.BigEndian, q.Type)
+		binary.Write(buf, binary.BigEndian, q.Class)
+	}
+
+	sections := []struct {
+		name    string
+		records []ResourceRecord
+	}{
+		{"answer", m.Answers},
+		{"authority", m.Authority},
+		{"additional", m.Additional},
+	}
+	for _, section := range sections {
+		for i := range section.records {
+			if err := section.records[i].pack(buf, compression); err != nil {
+				return nil, fmt.Errorf("failed to pack %s %d: %w", section.name, i, err)
+			}
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Copy returns a deep copy of the message: its header, sections, records, record
+// data and Raw bytes can all be modified without affecting the original.
+func (m *DNSMessage) Copy() *DNSMessage {
+	c := *m
+	c.Raw = bytes.Clone(m.Raw)
+	c.Questions = append([]Question(nil), m.Questions...)
+	c.Answers = copyRecords(m.Answers)
+	c.Authority = copyRecords(m.Authority)
+	c.Additional = copyRecords(m.Additional)
+	return &c
+}
+
+// copyRecords returns a copy of records that shares neither RData bytes nor
+// decoded Data values with the original.
+func copyRecords(records []ResourceRecord) []ResourceRecord {
+	if len(records) == 0 {
+		return nil
+	}
+	c := make([]ResourceRecord, len(records))
+	for i, rr := range records {
+		rr.RData = bytes.Clone(rr.RData)
+		if rr.Data != nil {
+			rr.Data = cloneRData(rr.Type, rr.Data)
+		}
+		c[i] = rr
+	}
+	return c
+}
+
+// setID sets the message ID in the header and, when the message has them, in its
+// Raw bytes, so that both keep describing the same message.
+func (m *DNSMessage) setID(id uint16) {
+	m.Header.ID = id
+	if len(m.Raw) >= 2 {
+		binary.BigEndian.PutUint16(m.Raw, id)
+	}
+}
+
+// Unpack parses a DNS message in wire format into a DNSMessage. It is the exact
+// inverse of Pack: every section is decoded, compressed names are expanded both in
+// owner names and in the RDATA of well-known record types, and RDLength reflects
+// the length of the expanded RData.
+//
+// Unlike the resolver, Unpack does not interpret the response code, so it can be
+// used on queries and on error responses alike. Returns an error if the message is
+// truncated or otherwise malformed.
+func Unpack(data []byte) (*DNSMessage, error) {
+	header, err := UnpackHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := 12
+	msg := &DNSMessage{Header: header}
+
+	for i := 0; i < int(header.QDCOUNT); i++ {
+		q, n, err := parseQuestion(data, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse question %d: %w", i, err)
+		}
+		msg.Questions = append(msg.Questions, q)
+		offset += n
+	}
+
+	sections := []struct {
+		name    string
+		count   uint16
+		records *[]ResourceRecord
+	}{
+		{"answer", header.ANCOUNT, &msg.Answers},
+		{"authority", header.NSCOUNT, &msg.Authority},
+		{"additional", header.ARCOUNT, &msg.Additional},
+	}
+	for _, section := range sections {
+		for i := 0; i < int(section.count); i++ {
+			rr, next, err := ParseResourceRecord(data, offset)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s %d: %w", section.name, i, err)
+			}
+			*section.records = append(*section.records, rr)
+			offset = next
+		}
+	}
+
+	return msg, nil
 }
 
 // Header represents the DNS message header section as defined in RFC 1035.
@@ -30,6 +190,16 @@ type Header struct {
 	ARCOUNT uint16 // ARCOUNT specifies the number of resource records in the additional section
 }
 
+// Header flag bits as laid out in RFC 1035 section 4.1.1. The RCODE and OPCODE
+// fields are multi-bit values and are extracted with masks rather than flags.
+const (
+	FlagQR uint16 = 0x8000 // FlagQR marks the message as a response
+	FlagAA uint16 = 0x0400 // FlagAA indicates an authoritative answer
+	FlagTC uint16 = 0x0200 // FlagTC indicates the message was truncated
+	FlagRD uint16 = 0x0100 // FlagRD requests recursive resolution
+	FlagRA uint16 = 0x0080 // FlagRA indicates the server supports recursion
+)
+
 // Pack serializes the Header into a byte slice using network byte order.
 // The resulting 12-byte slice can be transmitted as the header portion of a DNS message.
 // Returns an error if binary encoding fails.
@@ -89,23 +259,62 @@ func UnpackHeader(data []byte) (Header, error) {
 // EncodeDomainName converts a human-readable domain name into DNS wire format.
 // The domain name is split into labels, each prefixed with its length byte,
 // and terminated with a zero byte. Each label must not exceed 63 characters
-// as per RFC 1035. Returns an error if any label exceeds the length limit.
+// as per RFC 1035. A trailing dot is accepted, and the empty name or "." encodes
+// the root. Returns an error if any label exceeds the length limit or is empty.
 //
 // Example:
 //
 //	EncodeDomainName("example.com") returns [7]example[3]com[0]
 func EncodeDomainName(domain string) ([]byte, error) {
 	var buf bytes.Buffer
+	if err := packDomainName(&buf, domain, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// packDomainName appends the wire encoding of domain to buf. When compression is
+// non-nil, it is used to replace any previously written suffix of the name with
+// a pointer (RFC 1035 section 4.1.4), and the suffixes written by this call are
+// recorded so later names can point at them. Compression keys are compared
+// case-sensitively: a pointer makes the decoder reproduce the earlier name's
+// case, so only identical suffixes are shared, which keeps Unpack an exact
+// inverse of Pack and preserves randomized case in query names.
+func packDomainName(buf *bytes.Buffer, domain string, compression map[string]int) error {
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" {
+		buf.WriteByte(0)
+		return nil
+	}
+	if len(domain)+2 > 255 {
+		return fmt.Errorf("domain name '%s' exceeds 255 octets", domain)
+	}
+
 	segments := strings.Split(domain, ".")
-	for _, segment := range segments {
+	for i, segment := range segments {
 		if len(segment) > 63 {
-			return nil, fmt.Errorf("domain segment '%s' is longer than 63 characters", segment)
+			return fmt.Errorf("domain segment '%s' is longer than 63 characters", segment)
 		}
+		if segment == "" {
+			return fmt.Errorf("domain name '%s' contains an empty label", domain)
+		}
+
+		if compression != nil {
+			suffix := strings.Join(segments[i:], ".")
+			if pointer, ok := compression[suffix]; ok {
+				binary.Write(buf, binary.BigEndian, uint16(0xC000|pointer))
+				return nil
+			}
+			if buf.Len() <= 0x3FFF {
+				compression[suffix] = buf.Len()
+			}
+		}
+
 		buf.WriteByte(byte(len(segment)))
 		buf.WriteString(segment)
 	}
 	buf.WriteByte(0)
-	return buf.Bytes(), nil
+	return nil
 }
 
 // DecodeDomainName extracts a domain name from DNS wire format starting at the given offset.
@@ -118,56 +327,57 @@ func EncodeDomainName(domain string) ([]byte, error) {
 //   - Regular labels with length-prefixed strings
 //   - Compression pointers that reference earlier positions in the message
 //   - Proper boundary checking to prevent buffer overruns
-//   - Recursive decompression of nested pointers
+//   - Chains of pointers, each of which must point before the previous one, so
+//     that malformed messages cannot make decoding loop
+//   - The 255-octet limit on the length of a name (RFC 1035 section 3.1)
 func DecodeDomainName(fullMessage []byte, offset int) (string, int, error) {
 	var labels []string
-	startOffset := offset
 	bytesRead := 0
+	nameLen := 1 // the terminating root label
+	limit := offset
 	jumped := false
 
-	for {
-		if offset >= len(fullMessage) {
-			return "", 0, fmt.Errorf("offset %d out of bounds", offset)
+	for pos := offset; ; {
+		if pos < 0 || pos >= len(fullMessage) {
+			return "", 0, fmt.Errorf("offset %d out of bounds", pos)
 		}
-		length := int(fullMessage[offset])
-		offset++
+		length := int(fullMessage[pos])
 
-		if length == 0 {
-			if !jumped {
-				bytesRead = offset - startOffset
+		switch length & 0xC0 {
+		case 0x00:
+			if length == 0 {
+				if !jumped {
+					bytesRead = pos + 1 - offset
+				}
+				return strings.Join(labels, "."), bytesRead, nil
 			}
-			break
-		}
-
-		if (length & 0xC0) == 0xC0 {
-			if offset >= len(fullMessage) {
-				return "", 0, fmt.Errorf("malformed pointer at offset %d", offset-1)
+			if pos+1+length > len(fullMessage) {
+				return "", 0, fmt.Errorf("label length %d extends beyond message boundary", length)
 			}
-			pointer := int(binary.BigEndian.Uint16(fullMessage[offset-1:offset+1]) & 0x3FFF)
-
-			pointedName, _, err := DecodeDomainName(fullMessage, pointer)
-			if err != nil {
-				return "", 0, fmt.Errorf("failed to decode pointed name: %w", err)
+			nameLen += 1 + length
+			if nameLen > 255 {
+				return "", 0, fmt.Errorf("domain name at offset %d exceeds 255 octets", offset)
+			}
+			labels = append(labels, string(fullMessage[pos+1:pos+1+length]))
+			pos += 1 + length
+		case 0xC0:
+			if pos+1 >= len(fullMessage) {
+				return "", 0, fmt.Errorf("malformed pointer at offset %d", pos)
+			}
+			pointer := int(binary.BigEndian.Uint16(fullMessage[pos:pos+2]) & 0x3FFF)
+			// Each pointer must lead strictly before the start of the labels it
+			// continues, which rules out loops however the pointers are chained.
+			if pointer >= limit {
+				return "", 0, fmt.Errorf("pointer at offset %d does not point backwards", pos)
 			}
-			labels = append(labels, pointedName)
-
 			if !jumped {
-				bytesRead = offset - startOffset + 1
+				bytesRead = pos + 2 - offset
 				jumped = true
 			}
-			return strings.Join(labels, "."), bytesRead, nil
+			limit = pointer
+			pos = pointer
+		default:
+			return "", 0, fmt.Errorf("unsupported label type 0x%02x at offset %d", length&0xC0, pos)
 		}
-
-		if offset+length > len(fullMessage) {
-			return "", 0, fmt.Errorf("label length %d extends beyond message boundary", length)
-		}
-		labels = append(labels, string(fullMessage[offset:offset+length]))
-		offset += length
 	}
-
-	if !jumped {
-		bytesRead = offset - startOffset
-	}
-
-	return strings.Join(labels, "."), bytesRead, nil
 }
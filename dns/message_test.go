@@ -0,0 +1,132 @@
+package dns
+
+import (
+	"bytes"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDecodeDomainName(t *testing.T) {
+	// "example.com" at offset 0, then "www" followed by a pointer to it at offset 13.
+	compressed := []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 3, 'w', 'w', 'w', 0xC0, 0x00}
+
+	tests := []struct {
+		name     string
+		message  []byte
+		offset   int
+		want     string
+		wantRead int
+		wantErr  string
+	}{
+		{name: "plain", message: compressed, offset: 0, want: "example.com", wantRead: 13},
+		{name: "compressed", message: compressed, offset: 13, want: "www.example.com", wantRead: 6},
+		{name: "root", message: []byte{0}, offset: 0, want: "", wantRead: 1},
+		{name: "pointer to itself", message: []byte{0xC0, 0x00}, offset: 0, wantErr: "does not point backwards"},
+		{name: "forward pointer", message: []byte{0xC0, 0x02, 0}, offset: 0, wantErr: "does not point backwards"},
+		{
+			name:    "pointer loop",
+			message: []byte{1, 'a', 0xC0, 0x04, 1, 'b', 0xC0, 0x00},
+			offset:  4,
+			wantErr: "does not point backwards",
+		},
+		{name: "truncated label", message: []byte{5, 'a', 'b'}, offset: 0, wantErr: "beyond message boundary"},
+		{name: "truncated pointer", message: []byte{0xC0}, offset: 0, wantErr: "malformed pointer"},
+		{name: "reserved label type", message: []byte{0x40, 0}, offset: 0, wantErr: "unsupported label type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, read, err := DecodeDomainName(tt.message, tt.offset)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("DecodeDomainName() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeDomainName() error = %v", err)
+			}
+			if got != tt.want || read != tt.wantRead {
+				t.Errorf("DecodeDomainName() = %q, %d, want %q, %d", got, read, tt.want, tt.wantRead)
+			}
+		})
+	}
+}
+
+func TestDecodeDomainNameLengthLimit(t *testing.T) {
+	// Five 63-byte labels make a 321-octet name, which must be rejected even
+	// though every label is individually valid.
+	var message []byte
+	for range 5 {
+		message = append(message, 63)
+		message = append(message, bytes.Repeat([]byte{'a'}, 63)...)
+	}
+	message = append(message, 0)
+
+	if _, _, err := DecodeDomainName(message, 0); err == nil || !strings.Contains(err.Error(), "255 octets") {
+		t.Fatalf("DecodeDomainName() error = %v, want 255-octet limit error", err)
+	}
+}
+
+func TestUnpackPointerLoop(t *testing.T) {
+	// A response whose question name is a pointer to itself.
+	message := []byte{
+		0x00, 0x01, 0x81, 0x80, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0xC0, 0x0C, 0x00, 0x01, 0x00, 0x01,
+	}
+	if _, err := Unpack(message); err == nil {
+		t.Fatal("Unpack() succeeded on a message with a compression loop")
+	}
+}
+
+func TestPackUnpackRoundTrip(t *testing.T) {
+	// Names that differ only in case must each come back exactly as written,
+	// in every section and inside record data.
+	msg := &DNSMessage{
+		Header:    Header{ID: 0xBEEF, Flags: FlagQR | FlagRD | FlagRA},
+		Questions: []Question{{Name: "ExAmPlE.com", Type: TypeA, Class: 1}},
+		Answers: []ResourceRecord{
+			{Name: "example.com", Type: TypeCNAME, Class: 1, TTL: 300, Data: &CNAME{Target: "WWW.example.COM"}},
+			{Name: "www.example.com", Type: TypeA, Class: 1, TTL: 60, Data: &A{Addr: netip.MustParseAddr("192.0.2.1")}},
+		},
+		Authority: []ResourceRecord{
+			{Name: "EXAMPLE.com", Type: TypeSOA, Class: 1, TTL: 3600, Data: &SOA{
+				MName: "Ns1.Example.com", RName: "hostmaster.example.com",
+				Serial: 2024010101, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300,
+			}},
+			{Name: "example.COM", Type: TypeNS, Class: 1, TTL: 3600, Data: &NS{Host: "ns1.example.com"}},
+		},
+		Additional: []ResourceRecord{
+			{Name: "NS1.EXAMPLE.COM", Type: TypeAAAA, Class: 1, TTL: 3600, Data: &AAAA{Addr: netip.MustParseAddr("2001:db8::53")}},
+			{Name: "ns1.example.com", Type: TypeMX, Class: 1, TTL: 3600, Data: &MX{Preference: 10, Exchange: "mail.EXAMPLE.com"}},
+		},
+	}
+
+	packed, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	got, err := Unpack(packed)
+	if err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+
+	if got.Header.ID != msg.Header.ID || got.Header.Flags != msg.Header.Flags {
+		t.Errorf("header = %+v, want ID and flags of %+v", got.Header, msg.Header)
+	}
+	if !slices.Equal(got.Questions, msg.Questions) {
+		t.Errorf("questions = %v, want %v", got.Questions, msg.Questions)
+	}
+	compareRecords(t, "answer", got.Answers, formatRecords(msg.Answers))
+	compareRecords(t, "authority", got.Authority, formatRecords(msg.Authority))
+	compareRecords(t, "additional", got.Additional, formatRecords(msg.Additional))
+
+	repacked, err := got.Pack()
+	if err != nil {
+		t.Fatalf("Pack() of the unpacked message error = %v", err)
+	}
+	if !bytes.Equal(repacked, packed) {
+		t.Errorf("Pack(Unpack(m)) = %x, want %x", repacked, packed)
+	}
+}
@@ -0,0 +1,187 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Rcode is a DNS response code. The four low bits are carried in the message
+// header (RFC 1035 section 4.1.1); EDNS(0) extends the code to twelve bits by
+// carrying the upper eight bits in the OPT pseudo-record (RFC 6891 section 6.1.3).
+type Rcode uint16
+
+const (
+	RcodeSuccess        Rcode = 0  // RcodeSuccess (NOERROR) indicates the query completed successfully
+	RcodeFormatError    Rcode = 1  // RcodeFormatError (FORMERR) indicates the server could not interpret the query
+	RcodeServerFailure  Rcode = 2  // RcodeServerFailure (SERVFAIL) indicates the server failed to process the query
+	RcodeNameError      Rcode = 3  // RcodeNameError (NXDOMAIN) indicates the queried name does not exist
+	RcodeNotImplemented Rcode = 4  // RcodeNotImplemented (NOTIMP) indicates the server does not support the query kind
+	RcodeRefused        Rcode = 5  // RcodeRefused (REFUSED) indicates the server refused the query for policy reasons
+	RcodeYXDomain       Rcode = 6  // RcodeYXDomain (YXDOMAIN) indicates a name exists when it should not (RFC 2136)
+	RcodeYXRRSet        Rcode = 7  // RcodeYXRRSet (YXRRSET) indicates an RRset exists when it should not (RFC 2136)
+	RcodeNXRRSet        Rcode = 8  // RcodeNXRRSet (NXRRSET) indicates an RRset does not exist when it should (RFC 2136)
+	RcodeNotAuth        Rcode = 9  // RcodeNotAuth (NOTAUTH) indicates the server is not authoritative for the zone
+	RcodeNotZone        Rcode = 10 // RcodeNotZone (NOTZONE) indicates a name is not within the zone (RFC 2136)
+	RcodeDSOTypeNI      Rcode = 11 // RcodeDSOTypeNI (DSOTYPENI) indicates an unsupported DSO type (RFC 8490)
+	RcodeBadVersion     Rcode = 16 // RcodeBadVersion (BADVERS) indicates an unsupported EDNS version (RFC 6891)
+	RcodeBadCookie      Rcode = 23 // RcodeBadCookie (BADCOOKIE) indicates a bad or missing server cookie (RFC 7873)
+)
+
+// rcodeNames maps response codes to the mnemonics used by dig(1) and the IANA registry.
+var rcodeNames = map[Rcode]string{
+	RcodeSuccess:        "NOERROR",
+	RcodeFormatError:    "FORMERR",
+	RcodeServerFailure:  "SERVFAIL",
+	RcodeNameError:      "NXDOMAIN",
+	RcodeNotImplemented: "NOTIMP",
+	RcodeRefused:        "REFUSED",
+	RcodeYXDomain:       "YXDOMAIN",
+	RcodeYXRRSet:        "YXRRSET",
+	RcodeNXRRSet:        "NXRRSET",
+	RcodeNotAuth:        "NOTAUTH",
+	RcodeNotZone:        "NOTZONE",
+	RcodeDSOTypeNI:      "DSOTYPENI",
+	RcodeBadVersion:     "BADVERS",
+	RcodeBadCookie:      "BADCOOKIE",
+}
+
+// String returns the conventional mnemonic for the response code, such as
+// "NOERROR" or "NXDOMAIN". Unassigned codes are formatted as "RCODEn".
+func (rc Rcode) String() string {
+	if name, ok := rcodeNames[rc]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", uint16(rc))
+}
+
+var (
+	// ErrFormatError indicates that the DNS server was unable to interpret the query.
+	// This corresponds to the FORMERR response code (RCODE 1) in DNS responses.
+	ErrFormatError = errors.New("format error (FORMERR)")
+
+	// ErrServerFailed indicates that the DNS server was unable to process the query.
+	// This corresponds to the SERVFAIL response code (RCODE 2) in DNS responses
+	// and typically indicates a problem with the authoritative server or network.
+	ErrServerFailed = errors.New("server failure (SERVFAIL)")
+
+	// ErrNameNotFound indicates that the queried domain name does not exist.
+	// This corresponds to the NXDOMAIN response code (RCODE 3) in DNS responses.
+	ErrNameNotFound = errors.New("domain name not found (NXDOMAIN)")
+
+	// ErrNotImplemented indicates that the DNS server does not support the requested kind of query.
+	// This corresponds to the NOTIMP response code (RCODE 4) in DNS responses.
+	ErrNotImplemented = errors.New("not implemented (NOTIMP)")
+
+	// ErrRefused indicates that the DNS server refused to answer the query for policy reasons.
+	// This corresponds to the REFUSED response code (RCODE 5) in DNS responses and is
+	// commonly returned by servers that do not offer recursion to the client.
+	ErrRefused = errors.New("query refused (REFUSED)")
+
+	// ErrYXDomain indicates that a name exists when it should not.
+	// This corresponds to the YXDOMAIN response code (RCODE 6) used by dynamic updates.
+	ErrYXDomain = errors.New("name exists when it should not (YXDOMAIN)")
+
+	// ErrYXRRSet indicates that an RRset exists when it should not.
+	// This corresponds to the YXRRSET response code (RCODE 7) used by dynamic updates.
+	ErrYXRRSet = errors.New("RRset exists when it should not (YXRRSET)")
+
+	// ErrNXRRSet indicates that an RRset that should exist does not.
+	// This corresponds to the NXRRSET response code (RCODE 8) used by dynamic updates.
+	ErrNXRRSet = errors.New("RRset does not exist (NXRRSET)")
+
+	// ErrNotAuth indicates that the server is not authoritative for the zone.
+	// This corresponds to the NOTAUTH response code (RCODE 9) in DNS responses.
+	ErrNotAuth = errors.New("server not authoritative for zone (NOTAUTH)")
+
+	// ErrNotZone indicates that a name used in the message is not within the zone.
+	// This corresponds to the NOTZONE response code (RCODE 10) used by dynamic updates.
+	ErrNotZone = errors.New("name not contained in zone (NOTZONE)")
+
+	// ErrDSOTypeNotImplemented indicates that the server does not support a DNS Stateful Operations type.
+	// This corresponds to the DSOTYPENI response code (RCODE 11) defined in RFC 8490.
+	ErrDSOTypeNotImplemented = errors.New("DSO type not implemented (DSOTYPENI)")
+
+	// ErrBadVersion indicates that the server does not implement the EDNS version of the query.
+	// This corresponds to the BADVERS extended response code (RCODE 16) defined in RFC 6891.
+	ErrBadVersion = errors.New("bad EDNS version (BADVERS)")
+
+	// ErrBadCookie indicates that the server rejected the query's DNS cookie.
+	// This corresponds to the BADCOOKIE extended response code (RCODE 23) defined in RFC 7873.
+	ErrBadCookie = errors.New("bad server cookie (BADCOOKIE)")
+)
+
+// rcodeErrors maps response codes to their sentinel errors.
+var rcodeErrors = map[Rcode]error{
+	RcodeFormatError:    ErrFormatError,
+	RcodeServerFailure:  ErrServerFailed,
+	RcodeNameError:      ErrNameNotFound,
+	RcodeNotImplemented: ErrNotImplemented,
+	RcodeRefused:        ErrRefused,
+	RcodeYXDomain:       ErrYXDomain,
+	RcodeYXRRSet:        ErrYXRRSet,
+	RcodeNXRRSet:        ErrNXRRSet,
+	RcodeNotAuth:        ErrNotAuth,
+	RcodeNotZone:        ErrNotZone,
+	RcodeDSOTypeNI:      ErrDSOTypeNotImplemented,
+	RcodeBadVersion:     ErrBadVersion,
+	RcodeBadCookie:      ErrBadCookie,
+}
+
+// ResponseError is returned when a server answers with a response code other than
+// NOERROR. It carries the complete response, so callers can still inspect the
+// authority section of a negative answer, for example the SOA record that
+// accompanies NXDOMAIN.
+//
+// ResponseError matches the sentinel error for its code with errors.Is:
+//
+//	msg, err := resolver.Resolve("missing.example.com", dns.TypeA)
+//	if errors.Is(err, dns.ErrNameNotFound) {
+//		var respErr *dns.ResponseError
+//		if errors.As(err, &respErr) {
+//			// respErr.Message.Authority holds the zone's SOA record
+//		}
+//	}
+type ResponseError struct {
+	Rcode   Rcode       // Rcode is the full response code, including any EDNS extension
+	Message *DNSMessage // Message is the complete response that carried the error
+}
+
+// Error returns the description of the sentinel error for the response code, or a
+// generic description for codes without one, followed by any Extended DNS Errors
+// the server attached to explain the failure.
+func (e *ResponseError) Error() string {
+	description := fmt.Sprintf("server returned response code %s", e.Rcode)
+	if err, ok := rcodeErrors[e.Rcode]; ok {
+		description = err.Error()
+	}
+	for _, ede := range e.ExtendedErrors() {
+		description += fmt.Sprintf("; EDE: %s", ede)
+	}
+	return description
+}
+
+// ExtendedErrors returns the Extended DNS Errors (RFC 8914) attached to the
+// response, such as the reason a validating resolver answered SERVFAIL.
+func (e *ResponseError) ExtendedErrors() []ExtendedError {
+	if e.Message == nil {
+		return nil
+	}
+	return e.Message.ExtendedErrors()
+}
+
+// Unwrap returns the sentinel error for the response code, such as ErrNameNotFound,
+// so that errors.Is keeps working for callers written against the sentinels.
+func (e *ResponseError) Unwrap() error {
+	return rcodeErrors[e.Rcode]
+}
+
+// Rcode returns the message's full response code. The four RCODE bits of the
+// header are combined with the extended RCODE bits of the OPT pseudo-record when
+// the message carries EDNS information.
+func (m *DNSMessage) Rcode() Rcode {
+	rcode := Rcode(m.Header.Flags & 0x000F)
+	if edns := m.EDNS(); edns != nil {
+		rcode |= Rcode(edns.ExtendedRcode) << 4
+	}
+	return rcode
+}
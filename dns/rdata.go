@@ -0,0 +1,380 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"strings"
+)
+
+// RData is the decoded, type-specific payload of a resource record. Each record type
+// supported by the package has a concrete implementation, so callers can use a type
+// switch or assertion instead of interpreting raw bytes:
+//
+//	for _, rr := range msg.Answers {
+//		if mx, ok := rr.Data.(*MX); ok {
+//			fmt.Println(mx.Preference, mx.Exchange)
+//		}
+//	}
+//
+// Record types without a dedicated implementation are represented by *Unknown,
+// which preserves the raw RDATA as described in RFC 3597.
+type RData interface {
+	// String returns the presentation form of the data, as printed by tools like dig(1).
+	String() string
+
+	// pack appends the wire encoding of the data to buf. Domain names are compressed
+	// using the compression map when the record type permits it; a nil map disables
+	// compression.
+	pack(buf *bytes.Buffer, compression map[string]int) error
+}
+
+// A holds the IPv4 address of an A record (RFC 1035 section 3.4.1).
+type A struct {
+	Addr netip.Addr // Addr is the IPv4 address the owner name maps to
+}
+
+// String returns the address in dotted decimal notation.
+func (a *A) String() string {
+	return a.Addr.String()
+}
+
+func (a *A) pack(buf *bytes.Buffer, compression map[string]int) error {
+	addr := a.Addr.Unmap()
+	if !addr.Is4() {
+		return fmt.Errorf("A record address %s is not IPv4", a.Addr)
+	}
+	ip := addr.As4()
+	buf.Write(ip[:])
+	return nil
+}
+
+// AAAA holds the IPv6 address of an AAAA record (RFC 3596).
+type AAAA struct {
+	Addr netip.Addr // Addr is the IPv6 address the owner name maps to
+}
+
+// String returns the address in its canonical RFC 5952 text form.
+func (a *AAAA) String() string {
+	return a.Addr.String()
+}
+
+func (a *AAAA) pack(buf *bytes.Buffer, compression map[string]int) error {
+	if !a.Addr.IsValid() || a.Addr.Is4() {
+		return fmt.Errorf("AAAA record address %s is not IPv6", a.Addr)
+	}
+	ip := a.Addr.As16()
+	buf.Write(ip[:])
+	return nil
+}
+
+// CNAME holds the canonical name an alias points to (RFC 1035 section 3.3.1).
+type CNAME struct {
+	Target string // Target is the canonical name for the owner of the record
+}
+
+// String returns the canonical name.
+func (c *CNAME) String() string {
+	return c.Target
+}
+
+func (c *CNAME) pack(buf *bytes.Buffer, compression map[string]int) error {
+	return packDomainName(buf, c.Target, compression)
+}
+
+// NS holds the name of an authoritative name server (RFC 1035 section 3.3.11).
+type NS struct {
+	Host string // Host is the name server that is authoritative for the owner name
+}
+
+// String returns the name server host name.
+func (n *NS) String() string {
+	return n.Host
+}
+
+func (n *NS) pack(buf *bytes.Buffer, compression map[string]int) error {
+	return packDomainName(buf, n.Host, compression)
+}
+
+// PTR holds the domain name a pointer record points to (RFC 1035 section 3.3.12).
+type PTR struct {
+	Host string // Host is the name the owner points to, e.g. the host name of an address
+}
+
+// String returns the host name.
+func (p *PTR) String() string {
+	return p.Host
+}
+
+func (p *PTR) pack(buf *bytes.Buffer, compression map[string]int) error {
+	return packDomainName(buf, p.Host, compression)
+}
+
+// MX holds a mail exchange and its preference (RFC 1035 section 3.3.9).
+type MX struct {
+	Preference uint16 // Preference orders exchanges; lower values are preferred
+	Exchange   string // Exchange is the host willing to act as a mail exchange
+}
+
+// String returns the preference followed by the exchange, e.g. "10 mail.example.com".
+func (m *MX) String() string {
+	return fmt.Sprintf("%d %s", m.Preference, m.Exchange)
+}
+
+func (m *MX) pack(buf *bytes.Buffer, compression map[string]int) error {
+	binary.Write(buf, binary.BigEndian, m.Preference)
+	return packDomainName(buf, m.Exchange, compression)
+}
+
+// SOA holds the start of authority data of a zone (RFC 1035 section 3.3.13). The
+// counters are in seconds, except Serial, which versions the zone's data.
+type SOA struct {
+	MName   string // MName is the primary name server for the zone
+	RName   string // RName is the mailbox of the person responsible, with "@" written as "."
+	Serial  uint32 // Serial is the version number of the zone
+	Refresh uint32 // Refresh is how often secondaries check the serial for changes
+	Retry   uint32 // Retry is how long secondaries wait to retry a failed refresh
+	Expire  uint32 // Expire is how long secondaries keep serving without a refresh
+	Minimum uint32 // Minimum bounds the TTL of negative answers for the zone (RFC 2308)
+}
+
+// String returns the fields in zone file order, e.g.
+// "ns1.example.com hostmaster.example.com 2024010101 7200 3600 1209600 3600".
+func (s *SOA) String() string {
+	return fmt.Sprintf("%s %s %d %d %d %d %d",
+		s.MName, s.RName, s.Serial, s.Refresh, s.Retry, s.Expire, s.Minimum)
+}
+
+func (s *SOA) pack(buf *bytes.Buffer, compression map[string]int) error {
+	if err := packDomainName(buf, s.MName, compression); err != nil {
+		return err
+	}
+	if err := packDomainName(buf, s.RName, compression); err != nil {
+		return err
+	}
+	for _, counter := range []uint32{s.Serial, s.Refresh, s.Retry, s.Expire, s.Minimum} {
+		binary.Write(buf, binary.BigEndian, counter)
+	}
+	return nil
+}
+
+// SRV holds the location of a service (RFC 2782). Clients contact the targets with
+// the lowest Priority first, choosing among targets of equal priority at random in
+// proportion to their Weight.
+type SRV struct {
+	Priority uint16 // Priority orders targets; lower values are tried first
+	Weight   uint16 // Weight is the relative share of selections among equal priorities
+	Port     uint16 // Port is the port on Target where the service is offered
+	Target   string // Target is the host providing the service; the root name means the service is unavailable
+}
+
+// String returns the fields in zone file order, e.g. "10 60 5060 sip.example.com".
+// A root target is written as ".".
+func (s *SRV) String() string {
+	target := s.Target
+	if target == "" {
+		target = "."
+	}
+	return fmt.Sprintf("%d %d %d %s", s.Priority, s.Weight, s.Port, target)
+}
+
+// pack never compresses the target, as RFC 2782 requires.
+func (s *SRV) pack(buf *bytes.Buffer, compression map[string]int) error {
+	for _, field := range []uint16{s.Priority, s.Weight, s.Port} {
+		binary.Write(buf, binary.BigEndian, field)
+	}
+	return packDomainName(buf, s.Target, nil)
+}
+
+// TXT holds the character strings of a text record (RFC 1035 section 3.3.14).
+// Long values are commonly split across several strings of up to 255 bytes each.
+type TXT struct {
+	Strings []string // Strings holds each character-string in wire order
+}
+
+// String returns each character-string quoted and separated by spaces.
+func (t *TXT) String() string {
+	quoted := make([]string, len(t.Strings))
+	for i, s := range t.Strings {
+		quoted[i] = fmt.Sprintf("%q", s)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (t *TXT) pack(buf *bytes.Buffer, compression map[string]int) error {
+	for _, s := range t.Strings {
+		if len(s) > 255 {
+			return fmt.Errorf("TXT string of %d bytes exceeds 255 bytes", len(s))
+		}
+		buf.WriteByte(byte(len(s)))
+		buf.WriteString(s)
+	}
+	return nil
+}
+
+// Unknown holds the raw RDATA of a record type the package does not decode.
+// It is represented using the generic encoding of RFC 3597, which keeps such
+// records intact when messages are unpacked and packed again.
+type Unknown struct {
+	Data []byte // Data is the uninterpreted RDATA
+}
+
+// String returns the RFC 3597 generic form, e.g. `\# 4 0a000001`.
+func (u *Unknown) String() string {
+	if len(u.Data) == 0 {
+		return `\# 0`
+	}
+	return fmt.Sprintf(`\# %d %s`, len(u.Data), hex.EncodeToString(u.Data))
+}
+
+func (u *Unknown) pack(buf *bytes.Buffer, compression map[string]int) error {
+	buf.Write(u.Data)
+	return nil
+}
+
+// unpackRData decodes the RDATA found in message[start:end] into the concrete RData
+// type for recordType. The whole message is needed so that compressed domain names
+// inside the RDATA can be expanded; names are never allowed to extend past end.
+func unpackRData(message []byte, recordType RecordType, start, end int) (RData, error) {
+	rdata := message[start:end]
+
+	switch recordType {
+	case TypeA:
+		if len(rdata) != 4 {
+			return nil, fmt.Errorf("A record data has length %d, want 4", len(rdata))
+		}
+		return &A{Addr: netip.AddrFrom4([4]byte(rdata))}, nil
+	case TypeAAAA:
+		if len(rdata) != 16 {
+			return nil, fmt.Errorf("AAAA record data has length %d, want 16", len(rdata))
+		}
+		return &AAAA{Addr: netip.AddrFrom16([16]byte(rdata))}, nil
+	case TypeCNAME:
+		target, err := unpackRDataName(message, start, end)
+		if err != nil {
+			return nil, err
+		}
+		return &CNAME{Target: target}, nil
+	case TypeNS:
+		host, err := unpackRDataName(message, start, end)
+		if err != nil {
+			return nil, err
+		}
+		return &NS{Host: host}, nil
+	case TypePTR:
+		host, err := unpackRDataName(message, start, end)
+		if err != nil {
+			return nil, err
+		}
+		return &PTR{Host: host}, nil
+	case TypeMX:
+		if len(rdata) < 3 {
+			return nil, fmt.Errorf("MX record data too short")
+		}
+		exchange, err := unpackRDataName(message, start+2, end)
+		if err != nil {
+			return nil, err
+		}
+		return &MX{Preference: binary.BigEndian.Uint16(rdata[:2]), Exchange: exchange}, nil
+	case TypeSOA:
+		return unpackSOA(message, start, end)
+	case TypeSRV:
+		if len(rdata) < 7 {
+			return nil, fmt.Errorf("SRV record data too short")
+		}
+		target, err := unpackRDataName(message, start+6, end)
+		if err != nil {
+			return nil, err
+		}
+		return &SRV{
+			Priority: binary.BigEndian.Uint16(rdata[0:2]),
+			Weight:   binary.BigEndian.Uint16(rdata[2:4]),
+			Port:     binary.BigEndian.Uint16(rdata[4:6]),
+			Target:   target,
+		}, nil
+	case TypeTXT:
+		var strs []string
+		for len(rdata) > 0 {
+			length := int(rdata[0])
+			if 1+length > len(rdata) {
+				return nil, fmt.Errorf("TXT string length %d exceeds record data", length)
+			}
+			strs = append(strs, string(rdata[1:1+length]))
+			rdata = rdata[1+length:]
+		}
+		return &TXT{Strings: strs}, nil
+	case TypeOPT:
+		return unpackOPT(rdata)
+	case TypeSVCB:
+		return unpackSVCB(message, start, end)
+	case TypeHTTPS:
+		svcb, err := unpackSVCB(message, start, end)
+		if err != nil {
+			return nil, err
+		}
+		return &HTTPS{SVCB: *svcb}, nil
+	default:
+		data := make([]byte, len(rdata))
+		copy(data, rdata)
+		return &Unknown{Data: data}, nil
+	}
+}
+
+// cloneRData returns an independent copy of data, made by packing it without
+// compression and decoding the result. Data that does not survive the round trip
+// as the same type, such as a value that does not match recordType, is returned
+// as it is.
+func cloneRData(recordType RecordType, data RData) RData {
+	var buf bytes.Buffer
+	if err := data.pack(&buf, nil); err != nil {
+		return data
+	}
+	clone, err := unpackRData(buf.Bytes(), recordType, 0, buf.Len())
+	if err != nil || reflect.TypeOf(clone) != reflect.TypeOf(data) {
+		return data
+	}
+	return clone
+}
+
+// unpackSOA decodes the RDATA of an SOA record found in message[start:end]: two
+// possibly compressed names followed by five 32-bit counters.
+func unpackSOA(message []byte, start, end int) (*SOA, error) {
+	mname, mnameLen, err := DecodeDomainName(message[:end], start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode SOA MNAME: %w", err)
+	}
+	rname, rnameLen, err := DecodeDomainName(message[:end], start+mnameLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode SOA RNAME: %w", err)
+	}
+
+	counters := message[start+mnameLen+rnameLen : end]
+	if len(counters) != 20 {
+		return nil, fmt.Errorf("SOA record has %d bytes of counters, want 20", len(counters))
+	}
+	return &SOA{
+		MName:   mname,
+		RName:   rname,
+		Serial:  binary.BigEndian.Uint32(counters[0:4]),
+		Refresh: binary.BigEndian.Uint32(counters[4:8]),
+		Retry:   binary.BigEndian.Uint32(counters[8:12]),
+		Expire:  binary.BigEndian.Uint32(counters[12:16]),
+		Minimum: binary.BigEndian.Uint32(counters[16:20]),
+	}, nil
+}
+
+// unpackRDataName decodes a domain name that must occupy message[start:end] exactly.
+// Compression pointers may refer to any earlier part of the message.
+func unpackRDataName(message []byte, start, end int) (string, error) {
+	name, nameLen, err := DecodeDomainName(message[:end], start)
+	if err != nil {
+		return "", err
+	}
+	if start+nameLen != end {
+		return "", fmt.Errorf("record data length does not match embedded name")
+	}
+	return name, nil
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"strings"
 )
 
 // RecordType represents the numeric identifier for DNS resource record types as defined in RFC 1035.
@@ -36,6 +35,31 @@ const (
 	// TypeNS identifies name server records that delegate authority for a DNS zone to specific name servers.
 	// NS records define which servers are authoritative for answering queries about a particular domain.
 	TypeNS RecordType = 2
+
+	// TypeSOA identifies start of authority records that mark the apex of a DNS zone.
+	// Negative answers carry the zone's SOA record, whose MINIMUM field bounds how long
+	// the absence of a name may be cached (RFC 2308).
+	TypeSOA RecordType = 6
+
+	// TypePTR identifies pointer records that map a name to another name, most commonly
+	// an address under in-addr.arpa or ip6.arpa to a host name for reverse lookups.
+	TypePTR RecordType = 12
+
+	// TypeSRV identifies service location records that name the host and port offering a
+	// service such as _sip._tcp.example.com, with a priority and weight for each (RFC 2782).
+	TypeSRV RecordType = 33
+
+	// TypeOPT identifies the OPT pseudo-record that carries EDNS(0) information (RFC 6891).
+	// It never describes DNS data; it only appears in the additional section of a message.
+	TypeOPT RecordType = 41
+
+	// TypeSVCB identifies service binding records that describe the endpoints of a service
+	// together with parameters such as ALPN protocols and address hints (RFC 9460).
+	TypeSVCB RecordType = 64
+
+	// TypeHTTPS identifies the SVCB variant for HTTPS origins, which tells clients about
+	// HTTP/3 support, Encrypted ClientHello configurations and alternative endpoints.
+	TypeHTTPS RecordType = 65
 )
 
 // String returns the standard textual representation of the DNS record type.
@@ -57,6 +81,18 @@ func (rt RecordType) String() string {
 		return "TXT"
 	case TypeNS:
 		return "NS"
+	case TypeSOA:
+		return "SOA"
+	case TypePTR:
+		return "PTR"
+	case TypeSRV:
+		return "SRV"
+	case TypeOPT:
+		return "OPT"
+	case TypeSVCB:
+		return "SVCB"
+	case TypeHTTPS:
+		return "HTTPS"
 	default:
 		return fmt.Sprintf("TYPE%d", rt)
 	}
@@ -101,7 +137,13 @@ type ResourceRecord struct {
 
 	// RData contains the resource-specific data whose format depends on the Type field.
 	// For example, A records contain 4-byte IPv4 addresses, while CNAME records contain domain names.
+	// Domain names embedded in the RData of well-known types are stored uncompressed.
 	RData []byte
+
+	// Data is the decoded form of RData, such as *A for address records or *MX for
+	// mail exchanges. Record types without a dedicated decoder use *Unknown.
+	// When a message is packed, Data takes precedence over RData if it is set.
+	Data RData
 }
 
 // ParseResourceRecord extracts a single DNS resource record from a binary DNS message.
@@ -110,6 +152,8 @@ type ResourceRecord struct {
 //
 // The function correctly handles DNS name compression when parsing the owner name field and validates
 // that all required fields can be safely read without exceeding the message boundaries.
+// The RDATA is decoded into Data using the full message, so compressed domain names
+// inside it are expanded, and RData and RDLength describe the uncompressed RDATA.
 // The returned offset points to the first byte immediately following the parsed record,
 // allowing for sequential parsing of multiple records.
 //
@@ -145,20 +189,59 @@ func ParseResourceRecord(message []byte, offset int) (ResourceRecord, int, error
 		return rr, 0, fmt.Errorf("RR data length exceeds message boundary")
 	}
 
-	rr.RData = make([]byte, rr.RDLength)
-	copy(rr.RData, message[offset:offset+int(rr.RDLength)])
-	offset += int(rr.RDLength)
+	end := offset + int(rr.RDLength)
+	data, err := unpackRData(message, rr.Type, offset, end)
+	if err != nil {
+		return rr, 0, fmt.Errorf("failed to parse %s RR data: %w", rr.Type, err)
+	}
+	var rdata bytes.Buffer
+	if err := data.pack(&rdata, nil); err != nil {
+		return rr, 0, fmt.Errorf("failed to parse %s RR data: %w", rr.Type, err)
+	}
+	rr.Data = data
+	rr.RData = rdata.Bytes()
+	rr.RDLength = uint16(len(rr.RData))
 
-	return rr, offset, nil
+	return rr, end, nil
 }
 
-// RDataString converts the binary resource data to a human-readable string representation.
-// It interprets the RData field according to the record type and formats it appropriately
-// for display or logging purposes. The method handles DNS name compression by requiring
-// the complete original message to resolve any compressed domain names in the RData.
-//
-// For unsupported record types or malformed data, it returns a descriptive error message
-// rather than failing, making it safe to use for debugging and logging purposes.
+// pack appends the wire encoding of the resource record to buf, compressing the
+// owner name and, for well-known record types, the domain names embedded in the
+// record data. Data is packed when set; otherwise RData is written verbatim.
+// RDLENGTH is computed from the packed RDATA rather than taken from RDLength.
+func (rr *ResourceRecord) pack(buf *bytes.Buffer, compression map[string]int) error {
+	if err := packDomainName(buf, rr.Name, compression); err != nil {
+		return err
+	}
+	binary.Write(buf, binary.BigEndian, rr.Type)
+	binary.Write(buf, binary.BigEndian, rr.Class)
+	binary.Write(buf, binary.BigEndian, rr.TTL)
+
+	lengthOffset := buf.Len()
+	buf.Write([]byte{0, 0})
+
+	if rr.Data != nil {
+		if err := rr.Data.pack(buf, compression); err != nil {
+			return err
+		}
+	} else {
+		buf.Write(rr.RData)
+	}
+
+	rdLength := buf.Len() - lengthOffset - 2
+	if rdLength > 0xFFFF {
+		return fmt.Errorf("RR data of %d bytes is too long", rdLength)
+	}
+	binary.BigEndian.PutUint16(buf.Bytes()[lengthOffset:], uint16(rdLength))
+	return nil
+}
+
+// RDataString converts the resource data to a human-readable string representation.
+// It formats the decoded Data according to the record type for display or logging
+// purposes. Records parsed from a message already carry decoded Data, with any
+// compressed domain names expanded; for records built by hand, RData is decoded on
+// its own, and data that cannot be decoded that way, such as RDATA holding
+// compression pointers, is shown in the RFC 3597 generic form.
 //
 // Supported formats:
 //   - A records: dotted decimal notation (e.g., "192.0.2.1")
@@ -166,62 +249,30 @@ func ParseResourceRecord(message []byte, offset int) (ResourceRecord, int, error
 //   - CNAME/NS records: fully qualified domain names with compression resolved
 //   - MX records: preference value followed by exchange domain (e.g., "10 mail.example.com")
 //   - TXT records: quoted strings concatenated with spaces
+//   - Other records: the RFC 3597 generic form (e.g., "\# 4 0a000001")
 //
 // Parameters:
-//   - fullMessage: The complete DNS message buffer needed to resolve compressed names
+//   - fullMessage: The DNS message the record came from, such as DNSMessage.Raw.
+//     It is no longer needed to render any record and is ignored; it is kept so
+//     existing callers continue to compile.
 //
 // Returns:
 //   - string: Human-readable representation of the resource data
 func (rr *ResourceRecord) RDataString(fullMessage []byte) string {
-	switch rr.Type {
-	case TypeA:
-		if len(rr.RData) == 4 {
-			return fmt.Sprintf("%d.%d.%d.%d", rr.RData[0], rr.RData[1], rr.RData[2], rr.RData[3])
-		}
-	case TypeAAAA:
-		if len(rr.RData) == 16 {
-			var parts []string
-			for i := 0; i < 16; i += 2 {
-				parts = append(parts, fmt.Sprintf("%x", binary.BigEndian.Uint16(rr.RData[i:i+2])))
-			}
-			return strings.Join(parts, ":")
-		}
-	case TypeCNAME, TypeNS:
-		// The RData for CNAME/NS is another domain name, which might be compressed.
-		// We need to find the start of the RData in the full message to resolve pointers.
-		rdataStartOffset := bytes.Index(fullMessage, rr.RData)
-		if rdataStartOffset == -1 {
-			return "invalid CNAME/NS data"
-		}
-		name, _, err := DecodeDomainName(fullMessage, rdataStartOffset)
-		if err == nil {
-			return name
-		}
-	case TypeMX:
-		if len(rr.RData) > 2 {
-			preference := binary.BigEndian.Uint16(rr.RData[0:2])
-			rdataStartOffset := bytes.Index(fullMessage, rr.RData)
-			if rdataStartOffset == -1 {
-				return "invalid MX data"
-			}
-			exchange, _, err := DecodeDomainName(fullMessage, rdataStartOffset+2)
-			if err == nil {
-				return fmt.Sprintf("%d %s", preference, exchange)
-			}
-		}
-	case TypeTXT:
-		var texts []string
-		data := rr.RData
-		for len(data) > 0 {
-			length := int(data[0])
-			if len(data) > length {
-				texts = append(texts, fmt.Sprintf("%q", string(data[1:1+length])))
-				data = data[1+length:]
-			} else {
-				break
-			}
-		}
-		return strings.Join(texts, " ")
+	data := rr.Data
+	if data == nil {
+		data = rr.decodeRData()
+	}
+	return data.String()
+}
+
+// decodeRData decodes RData for records that were built by hand rather than parsed.
+// RData is decoded on its own, since there is no reliable way to tell where in a
+// message it came from; if that fails, the raw bytes are returned as *Unknown.
+func (rr *ResourceRecord) decodeRData() RData {
+	data, err := unpackRData(rr.RData, rr.Type, 0, len(rr.RData))
+	if err != nil {
+		return &Unknown{Data: bytes.Clone(rr.RData)}
 	}
-	return fmt.Sprintf("unsupported record type or malformed data (%v)", rr.RData)
+	return data
 }
@@ -0,0 +1,47 @@
+package dns
+
+import "testing"
+
+func TestRDataStringHandBuilt(t *testing.T) {
+	tests := []struct {
+		name string
+		rr   ResourceRecord
+		want string
+	}{
+		{
+			name: "uncompressed MX",
+			rr: ResourceRecord{
+				Type:  TypeMX,
+				RData: []byte{0, 10, 4, 'm', 'a', 'i', 'l', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0},
+			},
+			want: "10 mail.example.com",
+		},
+		{
+			name: "A",
+			rr:   ResourceRecord{Type: TypeA, RData: []byte{192, 0, 2, 1}},
+			want: "192.0.2.1",
+		},
+		{
+			// The pointer cannot be followed without knowing where the RDATA sat
+			// in its message, so the data is shown in the generic form.
+			name: "compressed CNAME",
+			rr:   ResourceRecord{Type: TypeCNAME, RData: []byte{3, 'w', 'w', 'w', 0xC0, 0x0C}},
+			want: `\# 6 03777777c00c`,
+		},
+		{
+			name: "decoded Data takes precedence",
+			rr:   ResourceRecord{Type: TypeNS, RData: []byte{0xC0, 0x0C}, Data: &NS{Host: "ns1.example.com"}},
+			want: "ns1.example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A message that contains the RDATA bytes elsewhere must not be
+			// searched for them.
+			message := append([]byte("decoy"), tt.rr.RData...)
+			if got := tt.rr.RDataString(message); got != tt.want {
+				t.Errorf("RDataString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package dns
+
+import (
+	"context"
+	"sync"
+)
+
+// flightGroup coalesces identical questions that are in flight at the same time,
+// so that only one query per question is sent upstream no matter how many callers
+// ask for it concurrently.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[CacheKey]*flight
+}
+
+// flight is a single upstream exchange shared by every caller asking the same
+// question while it runs.
+type flight struct {
+	done    chan struct{}      // done is closed once msg and err are set
+	msg     *DNSMessage        // msg is the shared response; callers receive copies
+	err     error              // err is the shared failure
+	waiters int                // waiters counts the callers still waiting on the flight
+	cancel  context.CancelFunc // cancel aborts the exchange once no caller is waiting
+}
+
+// exchangeShared behaves like exchange, but joins an identical exchange that is
+// already in flight instead of sending another query. Each caller receives its own
+// copy of the response, carrying its own query ID.
+//
+// The shared exchange is detached from the context of the caller that started it,
+// so cancelling that caller does not fail the others. A caller whose context ends
+// stops waiting and returns the context's error; the exchange itself is cancelled
+// only once every caller has stopped waiting. It remains bounded by Timeout.
+func (r *Resolver) exchangeShared(ctx context.Context, key CacheKey, query []byte, queryID uint16) (*DNSMessage, error) {
+	g := &r.flights
+
+	g.mu.Lock()
+	f, ok := g.flights[key]
+	if !ok {
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		if g.flights == nil {
+			g.flights = make(map[CacheKey]*flight)
+		}
+		g.flights[key] = f
+		go r.fly(flightCtx, key, f, query)
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.result(queryID)
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// fly runs the upstream exchange for a flight and publishes its outcome.
+func (r *Resolver) fly(ctx context.Context, key CacheKey, f *flight, query []byte) {
+	defer f.cancel()
+
+	f.msg, f.err = r.exchange(ctx, query)
+
+	g := &r.flights
+	g.mu.Lock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	g.mu.Unlock()
+	close(f.done)
+}
+
+// result returns a private copy of the flight's outcome for one caller. Responses,
+// including those carried by errors, are copied so that callers can modify what
+// they receive without affecting each other, and carry the caller's query ID in
+// both the header and Raw.
+func (f *flight) result(queryID uint16) (*DNSMessage, error) {
+	if f.err != nil {
+		return nil, callerError(f.err, queryID)
+	}
+
+	msg := f.msg.Copy()
+	msg.setID(queryID)
+	return msg, nil
+}
+
+// callerError rebuilds err for one caller, copying every response carried by a
+// *ResponseError in the chain, including those nested in an *UpstreamError. Other
+// errors carry no response and are shared as they are.
+func callerError(err error, queryID uint16) error {
+	switch err := err.(type) {
+	case *ResponseError:
+		if err.Message == nil {
+			return err
+		}
+		msg := err.Message.Copy()
+		msg.setID(queryID)
+		return &ResponseError{Rcode: err.Rcode, Message: msg}
+	case *ServerError:
+		return &ServerError{Server: err.Server, Err: callerError(err.Err, queryID)}
+	case *UpstreamError:
+		failures := make([]*ServerError, len(err.Errors))
+		for i, failure := range err.Errors {
+			failures[i] = &ServerError{Server: failure.Server, Err: callerError(failure.Err, queryID)}
+		}
+		return &UpstreamError{Errors: failures}
+	}
+	return err
+}
@@ -0,0 +1,185 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitForWaiters blocks until the flight for key has n waiting callers.
+func waitForWaiters(t *testing.T, r *Resolver, key CacheKey, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r.flights.mu.Lock()
+		f := r.flights.flights[key]
+		joined := f != nil && f.waiters == n
+		r.flights.mu.Unlock()
+		if joined {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("flight for %v never had %d waiters", key, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// flightResult is the outcome of one Resolve call joining a shared flight.
+type flightResult struct {
+	msg *DNSMessage
+	err error
+}
+
+// resolveTogether resolves example.com A from two callers that join the same
+// flight, then closes release to let the upstream answer, and returns what each
+// caller received.
+func resolveTogether(t *testing.T, resolver *Resolver, release chan struct{}) []flightResult {
+	t.Helper()
+	results := make(chan flightResult, 2)
+	resolve := func() {
+		msg, err := resolver.Resolve("example.com", TypeA)
+		results <- flightResult{msg, err}
+	}
+
+	key := NewCacheKey("example.com", TypeA, 1)
+	go resolve()
+	waitForWaiters(t, resolver, key, 1)
+	go resolve()
+	waitForWaiters(t, resolver, key, 2)
+	close(release)
+
+	return []flightResult{<-results, <-results}
+}
+
+func TestSharedFlightRawBelongsToCaller(t *testing.T) {
+	release := make(chan struct{})
+	resolver := NewResolver("fake")
+	resolver.Transport = transportFunc(func(ctx context.Context, server string, query []byte) ([]byte, error) {
+		<-release
+		return answer(query, RcodeSuccess, *aRecord("192.0.2.1", 60))
+	})
+
+	var msgs []*DNSMessage
+	for _, res := range resolveTogether(t, resolver, release) {
+		if res.err != nil {
+			t.Fatalf("Resolve() error = %v", res.err)
+		}
+		msgs = append(msgs, res.msg)
+	}
+
+	for _, msg := range msgs {
+		if id := binary.BigEndian.Uint16(msg.Raw); id != msg.Header.ID {
+			t.Errorf("Raw carries ID %d, header has ID %d", id, msg.Header.ID)
+		}
+	}
+	msgs[0].Raw[2] ^= 0xFF
+	if bytes.Equal(msgs[0].Raw[2:], msgs[1].Raw[2:]) {
+		t.Error("callers share the same Raw bytes")
+	}
+}
+
+func TestSharedFlightUpstreamErrorBelongsToCaller(t *testing.T) {
+	release := make(chan struct{})
+	resolver := NewResolver("fake")
+	resolver.Transport = transportFunc(func(ctx context.Context, server string, query []byte) ([]byte, error) {
+		<-release
+		return answer(query, RcodeServerFailure)
+	})
+
+	var msgs []*DNSMessage
+	for _, res := range resolveTogether(t, resolver, release) {
+		if !errors.Is(res.err, ErrServerFailed) {
+			t.Fatalf("Resolve() error = %v, want ErrServerFailed", res.err)
+		}
+		var respErr *ResponseError
+		if !errors.As(res.err, &respErr) {
+			t.Fatalf("Resolve() error = %v, want a *ResponseError in the chain", res.err)
+		}
+		msgs = append(msgs, respErr.Message)
+	}
+
+	if msgs[0] == msgs[1] {
+		t.Fatal("callers share the same SERVFAIL response")
+	}
+	for _, msg := range msgs {
+		if id := binary.BigEndian.Uint16(msg.Raw); id != msg.Header.ID {
+			t.Errorf("Raw carries ID %d, header has ID %d", id, msg.Header.ID)
+		}
+	}
+	msgs[0].Raw[2] ^= 0xFF
+	if bytes.Equal(msgs[0].Raw[2:], msgs[1].Raw[2:]) {
+		t.Error("callers share the same Raw bytes")
+	}
+}
+
+func TestCachedAnswerHasNoRaw(t *testing.T) {
+	resolver, clock, _ := cachingResolver(t, func(int) *ResourceRecord {
+		return aRecord("192.0.2.1", 60)
+	})
+
+	msg, err := resolver.Resolve("example.com", TypeA)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if msg.Raw == nil {
+		t.Fatal("answer from upstream has no Raw bytes")
+	}
+
+	clock.Advance(10 * time.Second)
+	msg, err = resolver.Resolve("example.com", TypeA)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if msg.Raw != nil {
+		t.Errorf("cached answer has Raw %x, want nil", msg.Raw)
+	}
+}
+
+func TestSharedFlightSurvivesLeaderCancel(t *testing.T) {
+	release := make(chan struct{})
+	flightErr := make(chan error, 1)
+	resolver := NewResolver("fake")
+	resolver.Transport = transportFunc(func(ctx context.Context, server string, query []byte) ([]byte, error) {
+		<-release
+		flightErr <- ctx.Err()
+		return answer(query, RcodeSuccess, *aRecord("192.0.2.1", 60))
+	})
+
+	key := NewCacheKey("example.com", TypeA, 1)
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := resolver.ResolveContext(leaderCtx, "example.com", TypeA)
+		leader <- err
+	}()
+	waitForWaiters(t, resolver, key, 1)
+
+	follower := make(chan flightResult, 1)
+	go func() {
+		msg, err := resolver.Resolve("example.com", TypeA)
+		follower <- flightResult{msg, err}
+	}()
+	waitForWaiters(t, resolver, key, 2)
+
+	cancelLeader()
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader error = %v, want context.Canceled", err)
+	}
+	waitForWaiters(t, resolver, key, 1)
+	close(release)
+
+	if err := <-flightErr; err != nil {
+		t.Errorf("shared exchange context ended with the leader: %v", err)
+	}
+	res := <-follower
+	if res.err != nil {
+		t.Fatalf("follower error = %v", res.err)
+	}
+	if len(res.msg.Answers) != 1 {
+		t.Errorf("follower got %d answers, want 1", len(res.msg.Answers))
+	}
+}
@@ -0,0 +1,485 @@
+package dns
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SvcParamKey identifies a service parameter of an SVCB or HTTPS record, as
+// assigned in the IANA "Service Parameter Keys (SvcParamKeys)" registry.
+type SvcParamKey uint16
+
+const (
+	SvcParamMandatory     SvcParamKey = 0 // SvcParamMandatory lists the keys a client must understand to use the record
+	SvcParamALPN          SvcParamKey = 1 // SvcParamALPN lists the supported ALPN protocol identifiers
+	SvcParamNoDefaultALPN SvcParamKey = 2 // SvcParamNoDefaultALPN excludes the scheme's default ALPN protocol
+	SvcParamPort          SvcParamKey = 3 // SvcParamPort overrides the scheme's default port
+	SvcParamIPv4Hint      SvcParamKey = 4 // SvcParamIPv4Hint lists IPv4 addresses of the target
+	SvcParamECH           SvcParamKey = 5 // SvcParamECH carries an Encrypted ClientHello configuration list
+	SvcParamIPv6Hint      SvcParamKey = 6 // SvcParamIPv6Hint lists IPv6 addresses of the target
+	SvcParamDOHPath       SvcParamKey = 7 // SvcParamDOHPath carries a DNS-over-HTTPS URI template (RFC 9461)
+)
+
+// svcParamKeyNames maps service parameter keys to their presentation names.
+var svcParamKeyNames = map[SvcParamKey]string{
+	SvcParamMandatory:     "mandatory",
+	SvcParamALPN:          "alpn",
+	SvcParamNoDefaultALPN: "no-default-alpn",
+	SvcParamPort:          "port",
+	SvcParamIPv4Hint:      "ipv4hint",
+	SvcParamECH:           "ech",
+	SvcParamIPv6Hint:      "ipv6hint",
+	SvcParamDOHPath:       "dohpath",
+}
+
+// String returns the presentation name of the key, such as "alpn", or "keyN" for
+// keys the package does not know (RFC 9460 section 2.1).
+func (k SvcParamKey) String() string {
+	if name, ok := svcParamKeyNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("key%d", uint16(k))
+}
+
+// SvcParam is a single decoded service parameter of an SVCB or HTTPS record. Each
+// key known to the package has a concrete implementation, such as *SvcALPN; other
+// keys are represented by *SvcUnknown.
+type SvcParam interface {
+	// Key returns the key that identifies the parameter.
+	Key() SvcParamKey
+
+	// String returns the parameter in presentation format, e.g. "alpn=h2,h3".
+	String() string
+
+	// pack appends the wire encoding of the parameter's value to buf.
+	pack(buf *bytes.Buffer) error
+}
+
+// SvcMandatory lists the keys a client must support for the record to be usable
+// (RFC 9460 section 8).
+type SvcMandatory struct {
+	Keys []SvcParamKey // Keys lists the mandatory keys in ascending order
+}
+
+// Key returns SvcParamMandatory.
+func (m *SvcMandatory) Key() SvcParamKey { return SvcParamMandatory }
+
+// String returns the keys by name, e.g. "mandatory=alpn,port".
+func (m *SvcMandatory) String() string {
+	names := make([]string, len(m.Keys))
+	for i, key := range m.Keys {
+		names[i] = key.String()
+	}
+	return "mandatory=" + strings.Join(names, ",")
+}
+
+func (m *SvcMandatory) pack(buf *bytes.Buffer) error {
+	if len(m.Keys) == 0 {
+		return fmt.Errorf("mandatory SvcParam lists no keys")
+	}
+	for i, key := range m.Keys {
+		if key == SvcParamMandatory {
+			return fmt.Errorf("mandatory SvcParam lists itself")
+		}
+		if i > 0 && key <= m.Keys[i-1] {
+			return fmt.Errorf("mandatory SvcParam keys are not in strictly ascending order")
+		}
+		binary.Write(buf, binary.BigEndian, key)
+	}
+	return nil
+}
+
+// SvcALPN lists the ALPN protocol identifiers the service supports, such as "h2"
+// and "h3" (RFC 9460 section 7.1).
+type SvcALPN struct {
+	IDs []string // IDs holds the protocol identifiers in order of preference
+}
+
+// Key returns SvcParamALPN.
+func (a *SvcALPN) Key() SvcParamKey { return SvcParamALPN }
+
+// String returns the identifiers separated by commas, e.g. "alpn=h2,h3". Commas
+// and backslashes within an identifier are escaped as RFC 9460 appendix A.1
+// describes for value lists.
+func (a *SvcALPN) String() string {
+	ids := make([]string, len(a.IDs))
+	for i, id := range a.IDs {
+		id = strings.ReplaceAll(id, `\`, `\\`)
+		ids[i] = strings.ReplaceAll(id, ",", `\,`)
+	}
+	return "alpn=" + svcParamValue(strings.Join(ids, ","))
+}
+
+func (a *SvcALPN) pack(buf *bytes.Buffer) error {
+	if len(a.IDs) == 0 {
+		return fmt.Errorf("alpn SvcParam lists no protocols")
+	}
+	for _, id := range a.IDs {
+		if id == "" || len(id) > 255 {
+			return fmt.Errorf("alpn protocol identifier of %d bytes is invalid", len(id))
+		}
+		buf.WriteByte(byte(len(id)))
+		buf.WriteString(id)
+	}
+	return nil
+}
+
+// SvcNoDefaultALPN indicates that the scheme's default protocol, such as
+// "http/1.1" for HTTPS records, is not supported (RFC 9460 section 7.1). It has
+// no value.
+type SvcNoDefaultALPN struct{}
+
+// Key returns SvcParamNoDefaultALPN.
+func (n *SvcNoDefaultALPN) Key() SvcParamKey { return SvcParamNoDefaultALPN }
+
+// String returns "no-default-alpn".
+func (n *SvcNoDefaultALPN) String() string { return "no-default-alpn" }
+
+func (n *SvcNoDefaultALPN) pack(buf *bytes.Buffer) error { return nil }
+
+// SvcPort is the port at which the service is reached, overriding the scheme's
+// default (RFC 9460 section 7.2).
+type SvcPort struct {
+	Port uint16 // Port is the TCP or UDP port of the service
+}
+
+// Key returns SvcParamPort.
+func (p *SvcPort) Key() SvcParamKey { return SvcParamPort }
+
+// String returns the port, e.g. "port=8443".
+func (p *SvcPort) String() string { return fmt.Sprintf("port=%d", p.Port) }
+
+func (p *SvcPort) pack(buf *bytes.Buffer) error {
+	binary.Write(buf, binary.BigEndian, p.Port)
+	return nil
+}
+
+// SvcIPv4Hint lists IPv4 addresses a client may use to reach the target before
+// its A records are resolved (RFC 9460 section 7.3).
+type SvcIPv4Hint struct {
+	Addrs []netip.Addr // Addrs holds the IPv4 addresses of the target
+}
+
+// Key returns SvcParamIPv4Hint.
+func (h *SvcIPv4Hint) Key() SvcParamKey { return SvcParamIPv4Hint }
+
+// String returns the addresses separated by commas, e.g. "ipv4hint=192.0.2.1,192.0.2.2".
+func (h *SvcIPv4Hint) String() string { return "ipv4hint=" + joinAddrs(h.Addrs) }
+
+func (h *SvcIPv4Hint) pack(buf *bytes.Buffer) error {
+	if len(h.Addrs) == 0 {
+		return fmt.Errorf("ipv4hint SvcParam lists no addresses")
+	}
+	for _, addr := range h.Addrs {
+		if !addr.Unmap().Is4() {
+			return fmt.Errorf("ipv4hint address %s is not IPv4", addr)
+		}
+		ip := addr.Unmap().As4()
+		buf.Write(ip[:])
+	}
+	return nil
+}
+
+// SvcECH carries the Encrypted ClientHello configuration list a TLS client uses to
+// encrypt its ClientHello to the service.
+type SvcECH struct {
+	Config []byte // Config is the ECHConfigList in wire format
+}
+
+// Key returns SvcParamECH.
+func (e *SvcECH) Key() SvcParamKey { return SvcParamECH }
+
+// String returns the configuration list in base64, as it appears in zone files.
+func (e *SvcECH) String() string { return "ech=" + base64.StdEncoding.EncodeToString(e.Config) }
+
+func (e *SvcECH) pack(buf *bytes.Buffer) error {
+	buf.Write(e.Config)
+	return nil
+}
+
+// SvcIPv6Hint lists IPv6 addresses a client may use to reach the target before
+// its AAAA records are resolved (RFC 9460 section 7.3).
+type SvcIPv6Hint struct {
+	Addrs []netip.Addr // Addrs holds the IPv6 addresses of the target
+}
+
+// Key returns SvcParamIPv6Hint.
+func (h *SvcIPv6Hint) Key() SvcParamKey { return SvcParamIPv6Hint }
+
+// String returns the addresses separated by commas, e.g. "ipv6hint=2001:db8::1".
+func (h *SvcIPv6Hint) String() string { return "ipv6hint=" + joinAddrs(h.Addrs) }
+
+func (h *SvcIPv6Hint) pack(buf *bytes.Buffer) error {
+	if len(h.Addrs) == 0 {
+		return fmt.Errorf("ipv6hint SvcParam lists no addresses")
+	}
+	for _, addr := range h.Addrs {
+		if !addr.IsValid() || addr.Is4() {
+			return fmt.Errorf("ipv6hint address %s is not IPv6", addr)
+		}
+		ip := addr.As16()
+		buf.Write(ip[:])
+	}
+	return nil
+}
+
+// SvcDOHPath is the URI template of a DNS-over-HTTPS service, relative to the
+// target, such as "/dns-query{?dns}" (RFC 9461 section 5).
+type SvcDOHPath struct {
+	Template string // Template is the relative URI template, in UTF-8
+}
+
+// Key returns SvcParamDOHPath.
+func (d *SvcDOHPath) Key() SvcParamKey { return SvcParamDOHPath }
+
+// String returns the template, e.g. "dohpath=/dns-query{?dns}".
+func (d *SvcDOHPath) String() string { return "dohpath=" + svcParamValue(d.Template) }
+
+func (d *SvcDOHPath) pack(buf *bytes.Buffer) error {
+	buf.WriteString(d.Template)
+	return nil
+}
+
+// SvcUnknown holds the raw value of a service parameter the package does not
+// decode, so that it survives unpacking and packing unchanged.
+type SvcUnknown struct {
+	Code SvcParamKey // Code is the parameter's key
+	Data []byte      // Data is the uninterpreted value
+}
+
+// Key returns the parameter's key.
+func (u *SvcUnknown) Key() SvcParamKey { return u.Code }
+
+// String returns the generic form of RFC 9460 section 2.1, e.g. `key65001=abc`.
+func (u *SvcUnknown) String() string {
+	if len(u.Data) == 0 {
+		return u.Code.String()
+	}
+	return u.Code.String() + "=" + svcParamValue(string(u.Data))
+}
+
+func (u *SvcUnknown) pack(buf *bytes.Buffer) error {
+	buf.Write(u.Data)
+	return nil
+}
+
+// SVCB holds a service binding record (RFC 9460), which tells a client where and
+// how to reach a service. A record with Priority zero is in AliasMode and only
+// points to another name; otherwise it is in ServiceMode, and Params describe
+// the endpoint at Target.
+type SVCB struct {
+	Priority uint16     // Priority orders ServiceMode records; zero marks AliasMode
+	Target   string     // Target is the endpoint's host name; the root name means the owner name itself
+	Params   []SvcParam // Params holds the service parameters in ascending key order
+}
+
+// Param returns the parameter with the given key, or nil if the record has none.
+//
+// Example:
+//
+//	if alpn, ok := https.Param(dns.SvcParamALPN).(*dns.SvcALPN); ok {
+//		fmt.Println(alpn.IDs)
+//	}
+func (s *SVCB) Param(key SvcParamKey) SvcParam {
+	for _, param := range s.Params {
+		if param.Key() == key {
+			return param
+		}
+	}
+	return nil
+}
+
+// String returns the record in presentation format, e.g.
+// "1 . alpn=h2,h3 ipv4hint=192.0.2.1". A root target is written as ".".
+func (s *SVCB) String() string {
+	target := s.Target
+	if target == "" {
+		target = "."
+	}
+	fields := []string{strconv.Itoa(int(s.Priority)), target}
+	for _, param := range s.Params {
+		fields = append(fields, param.String())
+	}
+	return strings.Join(fields, " ")
+}
+
+// pack writes Params in ascending key order, as RFC 9460 requires on the wire,
+// and never compresses the target name.
+func (s *SVCB) pack(buf *bytes.Buffer, compression map[string]int) error {
+	binary.Write(buf, binary.BigEndian, s.Priority)
+	if err := packDomainName(buf, s.Target, nil); err != nil {
+		return err
+	}
+
+	params := slices.SortedStableFunc(slices.Values(s.Params), func(a, b SvcParam) int {
+		return cmp.Compare(a.Key(), b.Key())
+	})
+	var value bytes.Buffer
+	for i, param := range params {
+		if i > 0 && param.Key() == params[i-1].Key() {
+			return fmt.Errorf("SvcParam %s appears more than once", param.Key())
+		}
+		value.Reset()
+		if err := param.pack(&value); err != nil {
+			return err
+		}
+		if value.Len() > 0xFFFF {
+			return fmt.Errorf("SvcParam %s value of %d bytes is too long", param.Key(), value.Len())
+		}
+		binary.Write(buf, binary.BigEndian, param.Key())
+		binary.Write(buf, binary.BigEndian, uint16(value.Len()))
+		buf.Write(value.Bytes())
+	}
+	return nil
+}
+
+// HTTPS holds an HTTPS record, the SVCB variant for the "https" and "http" URI
+// schemes (RFC 9460 section 9). It has the same format as SVCB.
+type HTTPS struct {
+	SVCB
+}
+
+// unpackSVCB decodes the RDATA of an SVCB or HTTPS record found in
+// message[start:end]: a priority, a target name and a list of parameters whose
+// keys must be in strictly ascending order.
+func unpackSVCB(message []byte, start, end int) (*SVCB, error) {
+	if end-start < 3 {
+		return nil, fmt.Errorf("SVCB record data too short")
+	}
+	target, targetLen, err := DecodeDomainName(message[:end], start+2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode SVCB target: %w", err)
+	}
+	svcb := &SVCB{
+		Priority: binary.BigEndian.Uint16(message[start : start+2]),
+		Target:   target,
+	}
+
+	rdata := message[start+2+targetLen : end]
+	for len(rdata) > 0 {
+		if len(rdata) < 4 {
+			return nil, fmt.Errorf("SvcParam header truncated")
+		}
+		key := SvcParamKey(binary.BigEndian.Uint16(rdata[0:2]))
+		length := int(binary.BigEndian.Uint16(rdata[2:4]))
+		if 4+length > len(rdata) {
+			return nil, fmt.Errorf("SvcParam %s length %d exceeds record data", key, length)
+		}
+		if n := len(svcb.Params); n > 0 && key <= svcb.Params[n-1].Key() {
+			return nil, fmt.Errorf("SvcParam %s is out of order", key)
+		}
+		param, err := unpackSvcParam(key, rdata[4:4+length])
+		if err != nil {
+			return nil, err
+		}
+		svcb.Params = append(svcb.Params, param)
+		rdata = rdata[4+length:]
+	}
+	return svcb, nil
+}
+
+// unpackSvcParam decodes the value of the parameter identified by key.
+func unpackSvcParam(key SvcParamKey, value []byte) (SvcParam, error) {
+	switch key {
+	case SvcParamMandatory:
+		if len(value) == 0 || len(value)%2 != 0 {
+			return nil, fmt.Errorf("mandatory SvcParam has length %d", len(value))
+		}
+		m := &SvcMandatory{}
+		for i := 0; i < len(value); i += 2 {
+			m.Keys = append(m.Keys, SvcParamKey(binary.BigEndian.Uint16(value[i:i+2])))
+		}
+		return m, nil
+	case SvcParamALPN:
+		if len(value) == 0 {
+			return nil, fmt.Errorf("alpn SvcParam is empty")
+		}
+		a := &SvcALPN{}
+		for len(value) > 0 {
+			length := int(value[0])
+			if length == 0 || 1+length > len(value) {
+				return nil, fmt.Errorf("alpn protocol identifier length %d is invalid", length)
+			}
+			a.IDs = append(a.IDs, string(value[1:1+length]))
+			value = value[1+length:]
+		}
+		return a, nil
+	case SvcParamNoDefaultALPN:
+		if len(value) != 0 {
+			return nil, fmt.Errorf("no-default-alpn SvcParam has a value")
+		}
+		return &SvcNoDefaultALPN{}, nil
+	case SvcParamPort:
+		if len(value) != 2 {
+			return nil, fmt.Errorf("port SvcParam has length %d, want 2", len(value))
+		}
+		return &SvcPort{Port: binary.BigEndian.Uint16(value)}, nil
+	case SvcParamIPv4Hint:
+		if len(value) == 0 || len(value)%4 != 0 {
+			return nil, fmt.Errorf("ipv4hint SvcParam has length %d", len(value))
+		}
+		h := &SvcIPv4Hint{}
+		for i := 0; i < len(value); i += 4 {
+			h.Addrs = append(h.Addrs, netip.AddrFrom4([4]byte(value[i:i+4])))
+		}
+		return h, nil
+	case SvcParamECH:
+		return &SvcECH{Config: bytes.Clone(value)}, nil
+	case SvcParamIPv6Hint:
+		if len(value) == 0 || len(value)%16 != 0 {
+			return nil, fmt.Errorf("ipv6hint SvcParam has length %d", len(value))
+		}
+		h := &SvcIPv6Hint{}
+		for i := 0; i < len(value); i += 16 {
+			h.Addrs = append(h.Addrs, netip.AddrFrom16([16]byte(value[i:i+16])))
+		}
+		return h, nil
+	case SvcParamDOHPath:
+		return &SvcDOHPath{Template: string(value)}, nil
+	default:
+		return &SvcUnknown{Code: key, Data: bytes.Clone(value)}, nil
+	}
+}
+
+// joinAddrs returns addrs separated by commas.
+func joinAddrs(addrs []netip.Addr) string {
+	strs := make([]string, len(addrs))
+	for i, addr := range addrs {
+		strs[i] = addr.String()
+	}
+	return strings.Join(strs, ",")
+}
+
+// svcParamValue returns s as a zone file character-string: quotes and
+// backslashes are escaped, bytes outside printable ASCII are written as \DDD,
+// and the result is quoted if it is empty or contains spaces.
+func svcParamValue(s string) string {
+	var b strings.Builder
+	quote := s == ""
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			if c == ' ' || c == ';' || c == '(' || c == ')' {
+				quote = true
+			}
+			b.WriteByte(c)
+		}
+	}
+	if quote {
+		return `"` + b.String() + `"`
+	}
+	return b.String()
+}
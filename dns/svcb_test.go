@@ -0,0 +1,180 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// svcParamWire returns the wire encoding of one SvcParam.
+func svcParamWire(key SvcParamKey, value ...byte) []byte {
+	wire := binary.BigEndian.AppendUint16(nil, uint16(key))
+	wire = binary.BigEndian.AppendUint16(wire, uint16(len(value)))
+	return append(wire, value...)
+}
+
+// svcbRData returns the RDATA of a ServiceMode record with priority 1, the root
+// name as target and the given encoded parameters.
+func svcbRData(params ...[]byte) []byte {
+	rdata := []byte{0, 1, 0}
+	for _, param := range params {
+		rdata = append(rdata, param...)
+	}
+	return rdata
+}
+
+func TestSVCBRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		params []SvcParam
+		want   string
+	}{
+		{
+			name:   "mandatory",
+			params: []SvcParam{&SvcMandatory{Keys: []SvcParamKey{SvcParamALPN, SvcParamPort}}},
+			want:   "1 . mandatory=alpn,port",
+		},
+		{name: "alpn", params: []SvcParam{&SvcALPN{IDs: []string{"h2", "h3"}}}, want: "1 . alpn=h2,h3"},
+		{name: "alpn with comma", params: []SvcParam{&SvcALPN{IDs: []string{"a,b", "h2"}}}, want: `1 . alpn=a\\,b,h2`},
+		{name: "no-default-alpn", params: []SvcParam{&SvcNoDefaultALPN{}}, want: "1 . no-default-alpn"},
+		{name: "port", params: []SvcParam{&SvcPort{Port: 8443}}, want: "1 . port=8443"},
+		{
+			name:   "ipv4hint",
+			params: []SvcParam{&SvcIPv4Hint{Addrs: []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2")}}},
+			want:   "1 . ipv4hint=192.0.2.1,192.0.2.2",
+		},
+		{name: "ech", params: []SvcParam{&SvcECH{Config: []byte{1, 2, 3}}}, want: "1 . ech=AQID"},
+		{
+			name:   "ipv6hint",
+			params: []SvcParam{&SvcIPv6Hint{Addrs: []netip.Addr{netip.MustParseAddr("2001:db8::1")}}},
+			want:   "1 . ipv6hint=2001:db8::1",
+		},
+		{name: "dohpath", params: []SvcParam{&SvcDOHPath{Template: "/dns-query{?dns}"}}, want: "1 . dohpath=/dns-query{?dns}"},
+		{name: "unknown key", params: []SvcParam{&SvcUnknown{Code: 65001, Data: []byte("abc")}}, want: "1 . key65001=abc"},
+		{name: "unknown key with space", params: []SvcParam{&SvcUnknown{Code: 65001, Data: []byte("a \"b\"")}}, want: `1 . key65001="a \"b\""`},
+		{name: "unknown key without value", params: []SvcParam{&SvcUnknown{Code: 65002, Data: []byte{}}}, want: "1 . key65002"},
+		{
+			name:   "sorted on the wire",
+			params: []SvcParam{&SvcPort{Port: 443}, &SvcALPN{IDs: []string{"h2"}}},
+			want:   "1 . alpn=h2 port=443",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &DNSMessage{
+				Header:    Header{Flags: FlagQR},
+				Questions: []Question{{Name: "example.com", Type: TypeHTTPS, Class: 1}},
+				Answers: []ResourceRecord{{
+					Name: "example.com", Type: TypeHTTPS, Class: 1, TTL: 300,
+					Data: &HTTPS{SVCB: SVCB{Priority: 1, Params: tt.params}},
+				}},
+			}
+			packed, err := msg.Pack()
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+			got, err := Unpack(packed)
+			if err != nil {
+				t.Fatalf("Unpack() error = %v", err)
+			}
+
+			https, ok := got.Answers[0].Data.(*HTTPS)
+			if !ok {
+				t.Fatalf("Data = %T, want *HTTPS", got.Answers[0].Data)
+			}
+			if s := https.String(); s != tt.want {
+				t.Errorf("String() = %q, want %q", s, tt.want)
+			}
+			for _, param := range tt.params {
+				if unpacked := https.Param(param.Key()); !reflect.DeepEqual(unpacked, param) {
+					t.Errorf("Param(%s) = %#v, want %#v", param.Key(), unpacked, param)
+				}
+			}
+		})
+	}
+}
+
+func TestUnpackSVCBRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		rdata   []byte
+		wantErr string
+	}{
+		{
+			name:    "keys out of order",
+			rdata:   svcbRData(svcParamWire(SvcParamPort, 1, 187), svcParamWire(SvcParamALPN, 2, 'h', '2')),
+			wantErr: "out of order",
+		},
+		{
+			name:    "duplicate keys",
+			rdata:   svcbRData(svcParamWire(SvcParamALPN, 2, 'h', '2'), svcParamWire(SvcParamALPN, 2, 'h', '3')),
+			wantErr: "out of order",
+		},
+		{name: "truncated header", rdata: append(svcbRData(), 0, 1), wantErr: "header truncated"},
+		{name: "value past end", rdata: append(svcbRData(), 0, 3, 0, 4, 1), wantErr: "exceeds record data"},
+		{name: "odd mandatory", rdata: svcbRData(svcParamWire(SvcParamMandatory, 0, 1, 0)), wantErr: "mandatory SvcParam has length 3"},
+		{name: "empty alpn", rdata: svcbRData(svcParamWire(SvcParamALPN)), wantErr: "alpn SvcParam is empty"},
+		{name: "alpn past end", rdata: svcbRData(svcParamWire(SvcParamALPN, 3, 'h', '2')), wantErr: "identifier length 3"},
+		{name: "no-default-alpn with value", rdata: svcbRData(svcParamWire(SvcParamNoDefaultALPN, 1)), wantErr: "has a value"},
+		{name: "short port", rdata: svcbRData(svcParamWire(SvcParamPort, 1)), wantErr: "port SvcParam has length 1"},
+		{name: "long port", rdata: svcbRData(svcParamWire(SvcParamPort, 0, 0, 80)), wantErr: "port SvcParam has length 3"},
+		{name: "partial ipv4hint", rdata: svcbRData(svcParamWire(SvcParamIPv4Hint, 192, 0, 2, 1, 192)), wantErr: "ipv4hint SvcParam has length 5"},
+		{name: "partial ipv6hint", rdata: svcbRData(svcParamWire(SvcParamIPv6Hint, make([]byte, 15)...)), wantErr: "ipv6hint SvcParam has length 15"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := unpackSVCB(tt.rdata, 0, len(tt.rdata))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("unpackSVCB() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPackSVCBRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  []SvcParam
+		wantErr string
+	}{
+		{
+			name:    "duplicate keys",
+			params:  []SvcParam{&SvcPort{Port: 443}, &SvcPort{Port: 8443}},
+			wantErr: "appears more than once",
+		},
+		{
+			name:    "mandatory out of order",
+			params:  []SvcParam{&SvcMandatory{Keys: []SvcParamKey{SvcParamPort, SvcParamALPN}}},
+			wantErr: "strictly ascending",
+		},
+		{
+			name:    "mandatory lists itself",
+			params:  []SvcParam{&SvcMandatory{Keys: []SvcParamKey{SvcParamMandatory}}},
+			wantErr: "lists itself",
+		},
+		{name: "empty alpn", params: []SvcParam{&SvcALPN{}}, wantErr: "lists no protocols"},
+		{name: "empty alpn identifier", params: []SvcParam{&SvcALPN{IDs: []string{""}}}, wantErr: "identifier of 0 bytes"},
+		{
+			name:    "IPv6 in ipv4hint",
+			params:  []SvcParam{&SvcIPv4Hint{Addrs: []netip.Addr{netip.MustParseAddr("2001:db8::1")}}},
+			wantErr: "is not IPv4",
+		},
+		{
+			name:    "IPv4 in ipv6hint",
+			params:  []SvcParam{&SvcIPv6Hint{Addrs: []netip.Addr{netip.MustParseAddr("192.0.2.1")}}},
+			wantErr: "is not IPv6",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svcb := &SVCB{Priority: 1, Params: tt.params}
+			err := svcb.pack(&bytes.Buffer{}, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("pack() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,412 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSScheme is the prefix that selects DNS-over-TLS for an upstream server
+// address, as in "tls://1.1.1.1:853" or "tls://dns.quad9.net".
+const TLSScheme = "tls://"
+
+// DefaultTLSPort is the port used for DNS-over-TLS when a "tls://" server address
+// does not name one (RFC 7858 section 3.1).
+const DefaultTLSPort = "853"
+
+// ErrPinMismatch is returned when a DNS-over-TLS server presents a certificate
+// chain in which no public key matches any of the configured SPKI pins.
+var ErrPinMismatch = errors.New("no certificate matches the configured SPKI pins")
+
+// TLSTransport sends queries over DNS-over-TLS (RFC 7858): TLS connections to
+// port 853 carrying messages framed with the same two-byte length prefix as TCP.
+//
+// Connections are reused across queries and pipelined: many queries may be
+// outstanding on one connection at once, and responses are matched to queries by
+// ID in whatever order the server sends them. The transport assigns each query a
+// connection-unique ID on the wire and restores the caller's ID in the response,
+// so concurrent queries never collide. A connection closed by the server, which
+// RFC 7858 allows when idle, or left unusable by a failed write is replaced on the
+// next query.
+//
+// A Resolver uses its TLSTransport for every upstream whose address starts with
+// TLSScheme:
+//
+//	resolver := dns.NewResolver("tls://1.1.1.1:853")
+//	resolver.TLSTransport = &dns.TLSTransport{
+//		Config: &tls.Config{ServerName: "cloudflare-dns.com"},
+//	}
+//
+// A TLSTransport is safe for concurrent use and must not be copied after first use.
+type TLSTransport struct {
+	// Config is the TLS configuration used for new connections. When nil, the
+	// system roots are used. An empty ServerName defaults to the host of the
+	// server address.
+	Config *tls.Config
+
+	// Pins, when non-empty, restricts the servers accepted to those whose
+	// certificate chain contains a public key matching one of the pins, following
+	// the out-of-band key-pinned profile of RFC 7858 section 4.2. Each pin is the
+	// base64-encoded SHA-256 digest of a DER-encoded SubjectPublicKeyInfo, the
+	// format produced by SPKIPin. Pins are checked in addition to the verification
+	// performed by Config; set Config.InsecureSkipVerify to rely on pins alone, for
+	// example with a self-signed certificate.
+	Pins []string
+
+	mu    sync.Mutex
+	conns map[string]*tlsConn // conns holds the open connection to each address
+	dials map[string]*tlsDial // dials holds the connection attempts in progress
+}
+
+// tlsDial is a connection attempt in progress, which queries to the same address
+// wait for instead of dialing connections of their own.
+type tlsDial struct {
+	done    chan struct{} // done is closed when the attempt has finished
+	conn    *tlsConn      // conn is the new connection, set if the attempt succeeded
+	err     error         // err is the reason the attempt failed
+	aborted bool          // aborted is set if the attempt failed because its query gave up
+}
+
+// SPKIPin returns the SPKI pin of a certificate: the base64-encoded SHA-256 digest
+// of its DER-encoded SubjectPublicKeyInfo, as used by TLSTransport.Pins.
+func SPKIPin(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// Exchange sends query to server over DNS-over-TLS and returns the response. The
+// server address may carry the TLSScheme prefix and defaults to port 853. If the
+// query fails on a reused connection that the server has since closed, it is
+// retried once on a fresh connection.
+func (t *TLSTransport) Exchange(ctx context.Context, server string, query []byte) ([]byte, error) {
+	address, host, err := tlsAddress(server)
+	if err != nil {
+		return nil, err
+	}
+	if len(query) < 2 {
+		return nil, fmt.Errorf("query of %d bytes is too short", len(query))
+	}
+
+	for attempt := 0; ; attempt++ {
+		conn, reused, err := t.conn(ctx, address, host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to DNS server: %w", contextError(ctx, err))
+		}
+
+		response, err := conn.exchange(ctx, query)
+		if err != nil && reused && attempt == 0 && ctx.Err() == nil {
+			continue
+		}
+		return response, err
+	}
+}
+
+// Close closes every connection held by the transport. Outstanding queries fail;
+// later queries open new connections.
+func (t *TLSTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for address, conn := range t.conns {
+		conn.conn.Close()
+		delete(t.conns, address)
+	}
+	return nil
+}
+
+// conn returns the open connection to address, dialing one if there is none. It
+// reports whether the connection was reused rather than freshly dialed.
+//
+// The dial, including the TLS handshake, happens without holding t.mu, so a
+// server that never completes its handshake delays only the queries sent to it.
+// Concurrent queries to the same address share one attempt and stop waiting for
+// it when their own context is done.
+func (t *TLSTransport) conn(ctx context.Context, address, host string) (*tlsConn, bool, error) {
+	for {
+		t.mu.Lock()
+		if conn, ok := t.conns[address]; ok {
+			select {
+			case <-conn.done:
+				delete(t.conns, address)
+			default:
+				t.mu.Unlock()
+				return conn, true, nil
+			}
+		}
+
+		if dial, ok := t.dials[address]; ok {
+			t.mu.Unlock()
+			select {
+			case <-dial.done:
+			case <-ctx.Done():
+				return nil, false, ctx.Err()
+			}
+			if dial.err == nil {
+				return dial.conn, false, nil
+			}
+			if !dial.aborted {
+				return nil, false, dial.err
+			}
+			// The query that dialed gave up before the server was reached, which
+			// says nothing about the server; try again on this query's behalf.
+			continue
+		}
+
+		dial := &tlsDial{done: make(chan struct{})}
+		if t.dials == nil {
+			t.dials = make(map[string]*tlsDial)
+		}
+		t.dials[address] = dial
+		t.mu.Unlock()
+
+		dial.conn, dial.err = t.dial(ctx, address, host)
+		dial.aborted = dial.err != nil && ctx.Err() != nil
+
+		t.mu.Lock()
+		delete(t.dials, address)
+		if dial.err == nil {
+			if t.conns == nil {
+				t.conns = make(map[string]*tlsConn)
+			}
+			t.conns[address] = dial.conn
+		}
+		t.mu.Unlock()
+		close(dial.done)
+		return dial.conn, false, dial.err
+	}
+}
+
+// dial opens a new connection to address and starts reading responses from it.
+func (t *TLSTransport) dial(ctx context.Context, address, host string) (*tlsConn, error) {
+	dialer := tls.Dialer{Config: t.config(host)}
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &tlsConn{
+		conn:    netConn,
+		done:    make(chan struct{}),
+		pending: make(map[uint16]*tlsQuery),
+	}
+	conn.release = func() { t.forget(address, conn) }
+	go conn.read()
+	return conn, nil
+}
+
+// forget removes conn from the open connections if it is still the one held for
+// address, so that the next query to address dials a new connection.
+func (t *TLSTransport) forget(address string, conn *tlsConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conns[address] == conn {
+		delete(t.conns, address)
+	}
+}
+
+// config returns the TLS configuration for a connection to host, applying the
+// ServerName default and installing pin verification when Pins is set.
+func (t *TLSTransport) config(host string) *tls.Config {
+	config := &tls.Config{}
+	if t.Config != nil {
+		config = t.Config.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+
+	if len(t.Pins) > 0 {
+		pins := t.Pins
+		verify := config.VerifyConnection
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if verify != nil {
+				if err := verify(state); err != nil {
+					return err
+				}
+			}
+			return verifyPins(state.PeerCertificates, pins)
+		}
+	}
+	return config
+}
+
+// verifyPins checks that at least one certificate in the chain has a public key
+// matching one of the pins.
+func verifyPins(certs []*x509.Certificate, pins []string) error {
+	for _, cert := range certs {
+		pin := SPKIPin(cert)
+		for _, want := range pins {
+			if pin == want {
+				return nil
+			}
+		}
+	}
+	return ErrPinMismatch
+}
+
+// tlsAddress strips the TLSScheme prefix from a server address and adds the
+// default port when none is given. It returns the dial address and the host,
+// which is used as the default TLS server name.
+func tlsAddress(server string) (string, string, error) {
+	server = strings.TrimPrefix(server, TLSScheme)
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		host, port = strings.Trim(server, "[]"), DefaultTLSPort
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("invalid DNS-over-TLS server address %q", server)
+	}
+	return net.JoinHostPort(host, port), host, nil
+}
+
+// tlsConn is a single DNS-over-TLS connection shared by pipelined queries.
+type tlsConn struct {
+	conn      net.Conn
+	done      chan struct{} // done is closed when the connection stops reading
+	writeMu   sync.Mutex    // writeMu serializes writes so framed messages do not interleave
+	release   func()        // release removes the connection from its transport
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	pending map[uint16]*tlsQuery // pending maps wire IDs to outstanding queries
+	nextID  uint16
+	err     error // err is the read error that stopped the connection
+}
+
+// tlsQuery is an outstanding query on a tlsConn.
+type tlsQuery struct {
+	id        uint16      // id is the caller's query ID, restored in the response
+	responses chan []byte // responses receives the response once it arrives
+}
+
+// exchange sends query on the connection under a connection-unique ID and waits
+// for the matching response.
+func (c *tlsConn) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	wireID, pending, err := c.add(binary.BigEndian.Uint16(query))
+	if err != nil {
+		return nil, err
+	}
+	defer c.remove(wireID)
+
+	framed := bytes.Clone(query)
+	binary.BigEndian.PutUint16(framed, wireID)
+	if err := c.write(ctx, framed); err != nil {
+		return nil, fmt.Errorf("failed to send query: %w", contextError(ctx, err))
+	}
+
+	select {
+	case response := <-pending.responses:
+		return response, nil
+	case <-c.done:
+		return nil, fmt.Errorf("failed to read response: %w", c.err)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to read response: %w", ctx.Err())
+	}
+}
+
+// add registers an outstanding query and returns the wire ID allocated to it.
+func (c *tlsConn) add(id uint16) (uint16, *tlsQuery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return 0, nil, fmt.Errorf("connection closed: %w", c.err)
+	}
+	if len(c.pending) > 0xFFFF {
+		return 0, nil, fmt.Errorf("too many outstanding queries on connection")
+	}
+	for {
+		c.nextID++
+		if _, inUse := c.pending[c.nextID]; !inUse {
+			break
+		}
+	}
+	query := &tlsQuery{id: id, responses: make(chan []byte, 1)}
+	c.pending[c.nextID] = query
+	return c.nextID, query, nil
+}
+
+// remove forgets an outstanding query, so a late response to it is discarded.
+func (c *tlsConn) remove(wireID uint16) {
+	c.mu.Lock()
+	delete(c.pending, wireID)
+	c.mu.Unlock()
+}
+
+// write sends one framed message, bounded by the context's deadline and
+// interrupted if the context is cancelled. A TLS connection cannot be written to
+// again after a failed write, so any write error closes the connection.
+func (c *tlsConn) write(ctx context.Context, message []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	deadline, _ := ctx.Deadline()
+	c.conn.SetWriteDeadline(deadline)
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		c.conn.SetWriteDeadline(time.Unix(1, 0))
+		close(interrupted)
+	})
+	err := writeTCPMessage(c.conn, message)
+	if !stop() {
+		// Wait for the deadline to be moved before the next write sets its own.
+		<-interrupted
+	}
+	if err != nil {
+		c.close()
+	}
+	return err
+}
+
+// close closes the connection and removes it from its transport. Queries still
+// outstanding fail once the read loop notices. It is safe to call more than once.
+func (c *tlsConn) close() {
+	c.closeOnce.Do(func() {
+		c.conn.Close()
+		if c.release != nil {
+			c.release()
+		}
+	})
+}
+
+// read delivers responses to the queries waiting for them until the connection
+// is closed or fails, then fails every query still outstanding.
+func (c *tlsConn) read() {
+	for {
+		response, err := readTCPMessage(c.conn)
+		if err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			close(c.done)
+			c.close()
+			return
+		}
+		if len(response) < 2 {
+			continue
+		}
+
+		wireID := binary.BigEndian.Uint16(response)
+		c.mu.Lock()
+		query, ok := c.pending[wireID]
+		if ok {
+			delete(c.pending, wireID)
+		}
+		c.mu.Unlock()
+
+		if ok {
+			binary.BigEndian.PutUint16(response, query.id)
+			query.responses <- response
+		}
+	}
+}
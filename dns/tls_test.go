@@ -0,0 +1,313 @@
+package dns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// selfSignedCert returns a self-signed certificate for 127.0.0.1.
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dns.test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// serveDoT starts a DNS-over-TLS server on the loopback interface and returns
+// its address. Each accepted connection is handed to handle.
+func serveDoT(t *testing.T, cert tls.Certificate, handle func(conn net.Conn)) string {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// answerStream answers every query read from conn with an A record, in order.
+func answerStream(t *testing.T) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		for {
+			query, err := readTCPMessage(conn)
+			if err != nil {
+				return
+			}
+			response, err := answer(query, RcodeSuccess, *aRecord("192.0.2.1", 60))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := writeTCPMessage(conn, response); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// testQuery returns a packed query for example.com A with the given ID.
+func testQuery(t *testing.T, id uint16) []byte {
+	t.Helper()
+	msg := &DNSMessage{
+		Header:    Header{ID: id, Flags: FlagRD},
+		Questions: []Question{{Name: "example.com", Type: TypeA, Class: 1}},
+	}
+	query, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return query
+}
+
+func TestTLSTransportHungHandshakeDoesNotBlockOthers(t *testing.T) {
+	hung, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hung.Close()
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := hung.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn // never answer the handshake
+		}
+	}()
+
+	healthy := serveDoT(t, selfSignedCert(t), answerStream(t))
+	transport := &TLSTransport{Config: &tls.Config{InsecureSkipVerify: true}}
+	defer transport.Close()
+
+	hungCtx, cancelHung := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelHung()
+	go transport.Exchange(hungCtx, hung.Addr().String(), testQuery(t, 1))
+	select {
+	case conn := <-accepted:
+		defer conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("hung server was never dialed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := transport.Exchange(ctx, healthy, testQuery(t, 2)); err != nil {
+		t.Fatalf("Exchange() with a healthy server error = %v", err)
+	}
+
+	// A second query to the hung server waits for the handshake in progress,
+	// but only as long as its own context allows.
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelWait()
+	start := time.Now()
+	_, err = transport.Exchange(waitCtx, hung.Addr().String(), testQuery(t, 3))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Exchange() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("waiting query took %v, beyond its deadline", elapsed)
+	}
+}
+
+func TestTLSTransportPipelining(t *testing.T) {
+	var connections atomic.Int32
+	wireIDs := make(chan uint16, 2)
+	addr := serveDoT(t, selfSignedCert(t), func(conn net.Conn) {
+		connections.Add(1)
+		// Read both queries before answering either, then answer in reverse
+		// order, which only works if the client pipelines them.
+		var queries [][]byte
+		for range 2 {
+			query, err := readTCPMessage(conn)
+			if err != nil {
+				return
+			}
+			wireIDs <- binary.BigEndian.Uint16(query)
+			queries = append(queries, query)
+		}
+		for i := len(queries) - 1; i >= 0; i-- {
+			response, err := answer(queries[i], RcodeSuccess, *aRecord("192.0.2.1", 60))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			writeTCPMessage(conn, response)
+		}
+	})
+
+	transport := &TLSTransport{Config: &tls.Config{InsecureSkipVerify: true}}
+	defer transport.Close()
+	// Open the connection first so that both queries share it.
+	if _, _, err := transport.conn(context.Background(), addr, "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Both callers use the same ID; the transport must keep them apart.
+			response, err := transport.Exchange(ctx, addr, testQuery(t, 7))
+			if err != nil {
+				t.Errorf("Exchange() error = %v", err)
+				return
+			}
+			if id := binary.BigEndian.Uint16(response); id != 7 {
+				t.Errorf("response ID = %d, want the caller's ID 7", id)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := connections.Load(); got != 1 {
+		t.Errorf("server accepted %d connections, want 1", got)
+	}
+	if first, second := <-wireIDs, <-wireIDs; first == second {
+		t.Errorf("both queries were sent with wire ID %d", first)
+	}
+}
+
+func TestTLSTransportPins(t *testing.T) {
+	cert := selfSignedCert(t)
+	addr := serveDoT(t, cert, answerStream(t))
+
+	tests := []struct {
+		name    string
+		pins    []string
+		wantErr error
+	}{
+		{name: "matching pin", pins: []string{"bm90IHRoZSByaWdodCBwaW4=", SPKIPin(cert.Leaf)}},
+		{name: "mismatched pin", pins: []string{"bm90IHRoZSByaWdodCBwaW4="}, wantErr: ErrPinMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &TLSTransport{
+				Config: &tls.Config{InsecureSkipVerify: true},
+				Pins:   tt.pins,
+			}
+			defer transport.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err := transport.Exchange(ctx, TLSScheme+addr, testQuery(t, 1))
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exchange() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTLSTransportReconnectsAfterServerClose(t *testing.T) {
+	var connections atomic.Int32
+	addr := serveDoT(t, selfSignedCert(t), func(conn net.Conn) {
+		connections.Add(1)
+		// Answer a single query, then close the connection as an idle server may.
+		query, err := readTCPMessage(conn)
+		if err != nil {
+			return
+		}
+		response, err := answer(query, RcodeSuccess, *aRecord("192.0.2.1", 60))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		writeTCPMessage(conn, response)
+	})
+
+	transport := &TLSTransport{Config: &tls.Config{InsecureSkipVerify: true}}
+	defer transport.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := range 3 {
+		if _, err := transport.Exchange(ctx, addr, testQuery(t, uint16(i))); err != nil {
+			t.Fatalf("Exchange() %d error = %v", i, err)
+		}
+	}
+	if got := connections.Load(); got != 3 {
+		t.Errorf("server accepted %d connections, want 3", got)
+	}
+}
+
+func TestTLSTransportRedialsAfterFailedWrite(t *testing.T) {
+	var connections atomic.Int32
+	addr := serveDoT(t, selfSignedCert(t), func(conn net.Conn) {
+		connections.Add(1)
+		answerStream(t)(conn)
+	})
+
+	transport := &TLSTransport{Config: &tls.Config{InsecureSkipVerify: true}}
+	defer transport.Close()
+	if _, _, err := transport.conn(context.Background(), addr, "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A deadline that has already passed fails the write, which leaves the TLS
+	// connection unusable even though the server never closed it.
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := transport.Exchange(expired, addr, testQuery(t, 1)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Exchange() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := range 2 {
+		if _, err := transport.Exchange(ctx, addr, testQuery(t, uint16(i))); err != nil {
+			t.Fatalf("Exchange() %d after a failed write error = %v", i, err)
+		}
+	}
+	if got := connections.Load(); got != 2 {
+		t.Errorf("server accepted %d connections, want 2", got)
+	}
+}
@@ -0,0 +1,155 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Transport exchanges a packed DNS query with an upstream server and returns the
+// packed response. Implementations carry the message over a particular protocol;
+// they do not interpret it beyond what the protocol requires.
+//
+// The server string is the upstream address exactly as configured on the
+// Resolver, so a transport is free to define its own address syntax. The
+// response must carry the query's ID. Implementations must honor cancellation
+// and the deadline of ctx, and must be safe for concurrent use.
+//
+// UDPTransport, TLSTransport, HTTPSTransport and UDPPool implement Transport.
+// Custom implementations can route queries through proxies, serve them from
+// in-memory fakes, or replay recorded fixtures:
+//
+//	type fixtureTransport map[string][]byte
+//
+//	func (f fixtureTransport) Exchange(ctx context.Context, server string, query []byte) ([]byte, error) {
+//		...
+//	}
+//
+//	resolver := dns.NewResolver("fixtures")
+//	resolver.Transport = fixtureTransport{...}
+type Transport interface {
+	Exchange(ctx context.Context, server string, query []byte) ([]byte, error)
+}
+
+// transport returns the Transport used to reach server. A configured Transport
+// handles every server; otherwise the server's address scheme selects
+// DNS-over-TLS, DNS-over-HTTPS, or plain DNS over UDP and TCP.
+func (r *Resolver) transport(server string) Transport {
+	switch {
+	case r.Transport != nil:
+		return r.Transport
+	case strings.HasPrefix(server, TLSScheme):
+		if r.TLSTransport != nil {
+			return r.TLSTransport
+		}
+		return &r.defaultTLS
+	case strings.HasPrefix(server, HTTPSScheme):
+		if r.HTTPSTransport != nil {
+			return r.HTTPSTransport
+		}
+		return &r.defaultDoH
+	}
+
+	transport := &UDPTransport{ForceTCP: r.ForceTCP, Pool: r.UDPPool}
+	if r.EDNS != nil {
+		transport.UDPSize = r.EDNS.payloadSize()
+	}
+	return transport
+}
+
+// UDPTransport is the plain DNS Transport of RFC 1035. Queries are sent over UDP;
+// if the server sets the TC (truncation) bit in its reply, the same query is
+// transparently retried over TCP so that the full response is returned, as
+// described in RFC 1035 section 4.2.2 and RFC 7766.
+//
+// A Resolver without a Transport uses a UDPTransport configured from its
+// ForceTCP, UDPPool and EDNS settings for every "host:port" upstream.
+type UDPTransport struct {
+	ForceTCP bool     // ForceTCP sends every query over TCP instead of trying UDP first
+	UDPSize  int      // UDPSize is the UDP receive buffer size; zero means 512 bytes
+	Pool     *UDPPool // Pool, when non-nil, carries UDP queries over pooled sockets
+}
+
+// Exchange sends query to the server at address "host:port" and returns the
+// complete response, falling back to TCP when the UDP response is truncated.
+func (t *UDPTransport) Exchange(ctx context.Context, server string, query []byte) ([]byte, error) {
+	if t.ForceTCP {
+		return t.exchangeTCP(ctx, server, query)
+	}
+
+	response, err := t.exchangeUDP(ctx, server, query)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := UnpackHeader(response)
+	if err != nil {
+		return nil, err
+	}
+	if header.Flags&FlagTC != 0 {
+		return t.exchangeTCP(ctx, server, query)
+	}
+
+	return response, nil
+}
+
+// exchangeUDP transmits a DNS query over UDP and returns the response datagram.
+//
+// The method handles network-level concerns including:
+//   - UDP connection establishment and cleanup
+//   - Context deadline and cancellation for dialing, reading and writing
+//   - Response buffer sizing (512 bytes per RFC 1035, or UDPSize)
+//   - Proper connection closure to prevent resource leaks
+//
+// When Pool is set, the query is multiplexed over one of the pool's sockets.
+func (t *UDPTransport) exchangeUDP(ctx context.Context, server string, query []byte) ([]byte, error) {
+	if t.Pool != nil {
+		return t.Pool.Exchange(ctx, server, query)
+	}
+
+	conn, err := dialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to DNS server: %w", contextError(ctx, err))
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send query: %w", contextError(ctx, err))
+	}
+
+	bufferSize := 512
+	if t.UDPSize > 0 {
+		bufferSize = t.UDPSize
+	}
+	response := make([]byte, bufferSize)
+	n, err := conn.Read(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", contextError(ctx, err))
+	}
+
+	return response[:n], nil
+}
+
+// exchangeTCP transmits a DNS query over TCP and returns the complete response.
+// Messages sent over TCP are prefixed with a two-byte length field in network
+// byte order as defined in RFC 1035 section 4.2.2, which lifts the 512-byte
+// limit imposed on UDP responses.
+func (t *UDPTransport) exchangeTCP(ctx context.Context, server string, query []byte) ([]byte, error) {
+	conn, err := dialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to DNS server: %w", contextError(ctx, err))
+	}
+	defer conn.Close()
+
+	if err := writeTCPMessage(conn, query); err != nil {
+		return nil, fmt.Errorf("failed to send query: %w", contextError(ctx, err))
+	}
+
+	response, err := readTCPMessage(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", contextError(ctx, err))
+	}
+
+	return response, nil
+}
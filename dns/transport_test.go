@@ -0,0 +1,129 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+// listenUDPAndTCP opens a UDP socket and a TCP listener on the same loopback port,
+// as a DNS server listens on both.
+func listenUDPAndTCP(t *testing.T) (net.PacketConn, net.Listener) {
+	t.Helper()
+	for range 10 {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := net.ListenPacket("udp", listener.Addr().String())
+		if err != nil {
+			// The port is taken for UDP; try another.
+			listener.Close()
+			continue
+		}
+		t.Cleanup(func() {
+			conn.Close()
+			listener.Close()
+		})
+		return conn, listener
+	}
+	t.Fatal("no loopback port free for both UDP and TCP")
+	return nil, nil
+}
+
+// serveTruncating starts a server that answers every UDP query with an empty
+// truncated response and every TCP query with the full answer of 40 A records,
+// too large for a 512-byte datagram. It returns the server address and counters
+// of the queries received over each protocol.
+func serveTruncating(t *testing.T) (string, *atomic.Int32, *atomic.Int32) {
+	var udpQueries, tcpQueries atomic.Int32
+	conn, listener := listenUDPAndTCP(t)
+
+	var records []ResourceRecord
+	for i := range 40 {
+		records = append(records, *aRecord(fmt.Sprintf("192.0.2.%d", i+1), 60))
+	}
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			udpQueries.Add(1)
+			truncated, err := Unpack(buf[:n])
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			truncated.Header.Flags |= FlagQR | FlagTC
+			response, err := truncated.Pack()
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			conn.WriteTo(response, addr)
+		}
+	}()
+	go func() {
+		for {
+			tcpConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer tcpConn.Close()
+				query, err := readTCPMessage(tcpConn)
+				if err != nil {
+					return
+				}
+				tcpQueries.Add(1)
+				response, err := answer(query, RcodeSuccess, records...)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				writeTCPMessage(tcpConn, response)
+			}()
+		}
+	}()
+	return listener.Addr().String(), &udpQueries, &tcpQueries
+}
+
+func TestUDPTransportTCPFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		forceTCP bool
+		wantUDP  int32
+	}{
+		{name: "truncated UDP response", wantUDP: 1},
+		{name: "ForceTCP", forceTCP: true, wantUDP: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, udpQueries, tcpQueries := serveTruncating(t)
+			resolver := NewResolver(server)
+			resolver.ForceTCP = tt.forceTCP
+
+			msg, err := resolver.Resolve("example.com", TypeA)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if msg.Header.Flags&FlagTC != 0 || len(msg.Answers) != 40 {
+				t.Errorf("got %d answers with flags %#04x, want the full 40 without TC",
+					len(msg.Answers), msg.Header.Flags)
+			}
+			if len(msg.Raw) <= 512 {
+				t.Errorf("response is %d bytes, want more than fits in a 512-byte datagram", len(msg.Raw))
+			}
+			if got := udpQueries.Load(); got != tt.wantUDP {
+				t.Errorf("server received %d UDP queries, want %d", got, tt.wantUDP)
+			}
+			if got := tcpQueries.Load(); got != 1 {
+				t.Errorf("server received %d TCP queries, want 1", got)
+			}
+		})
+	}
+}
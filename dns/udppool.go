@@ -0,0 +1,378 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultUDPPoolSize is the number of sockets a UDPPool keeps per server when
+	// its Size is zero.
+	DefaultUDPPoolSize = 4
+
+	// DefaultUDPPoolMaxQueries is the number of queries a pooled socket carries
+	// before it is rotated when the pool's MaxQueries is zero.
+	DefaultUDPPoolMaxQueries = 1000
+
+	// DefaultUDPPoolMaxAge is how long a pooled socket is used before it is
+	// rotated when the pool's MaxAge is zero.
+	DefaultUDPPoolMaxAge = time.Minute
+)
+
+// errPoolClosed is returned by UDPPool.Exchange once the pool has been closed.
+var errPoolClosed = errors.New("UDP pool is closed")
+
+// UDPPool keeps long-lived UDP sockets to each upstream server and multiplexes
+// many outstanding queries over them, avoiding the cost of dialing a socket per
+// query and the ephemeral port exhaustion that causes under load.
+//
+// Responses are matched to queries by their ID and question section; datagrams
+// that match no outstanding query, such as late answers to abandoned queries or
+// spoofing attempts, are discarded. A response without a question section, which
+// servers may send with FORMERR, SERVFAIL, NOTIMP or REFUSED, is matched by ID
+// alone when exactly one outstanding query has that ID. To keep source ports unpredictable, every
+// socket is retired and replaced by a freshly dialed one after carrying MaxQueries
+// queries or reaching MaxAge, whichever comes first.
+//
+// A UDPPool is safe for concurrent use and may be shared by several resolvers.
+//
+// Example:
+//
+//	resolver := dns.NewResolver("8.8.8.8:53")
+//	resolver.UDPPool = dns.NewUDPPool(8)
+//	defer resolver.UDPPool.Close()
+type UDPPool struct {
+	Size       int           // Size is the number of sockets kept per server
+	MaxQueries int           // MaxQueries is the number of queries a socket carries before rotation
+	MaxAge     time.Duration // MaxAge is how long a socket is used before rotation
+
+	mu      sync.Mutex
+	servers map[string][]*pooledConn
+	next    int
+	closed  bool
+}
+
+// NewUDPPool creates a UDPPool that keeps size sockets per upstream server, with
+// the default rotation limits.
+func NewUDPPool(size int) *UDPPool {
+	return &UDPPool{
+		Size:       size,
+		MaxQueries: DefaultUDPPoolMaxQueries,
+		MaxAge:     DefaultUDPPoolMaxAge,
+	}
+}
+
+// muxKey identifies an outstanding query on a pooled socket. The question name is
+// lower-cased, since servers are not required to preserve its case.
+type muxKey struct {
+	id       uint16
+	question Question
+}
+
+// pooledConn is one long-lived socket of a UDPPool together with the queries
+// waiting for a response on it.
+type pooledConn struct {
+	pool    *UDPPool
+	server  string
+	conn    net.Conn
+	created time.Time
+	done    chan struct{} // done is closed when the socket stops reading
+
+	mu      sync.Mutex
+	pending map[muxKey]chan []byte
+	queries int   // queries counts the queries sent on the socket
+	retired bool  // retired sockets accept no new queries and close once drained
+	err     error // err is the read error that stopped the socket
+}
+
+// Exchange sends query to server over a pooled socket and waits for the matching
+// response, which is returned as received. The context bounds the wait; it does
+// not affect other queries sharing the socket.
+func (p *UDPPool) Exchange(ctx context.Context, server string, query []byte) ([]byte, error) {
+	key, err := newMuxKey(query)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, responses, err := p.register(ctx, server, key)
+	if err != nil {
+		return nil, err
+	}
+	defer pc.unregister(key)
+
+	if _, err := pc.conn.Write(query); err != nil {
+		return nil, fmt.Errorf("failed to send query: %w", err)
+	}
+
+	select {
+	case response := <-responses:
+		return response, nil
+	case <-pc.done:
+		return nil, fmt.Errorf("failed to read response: %w", pc.err)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to read response: %w", ctx.Err())
+	}
+}
+
+// Close closes every socket held by the pool. Queries waiting on them fail, and
+// later calls to Exchange return an error.
+func (p *UDPPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for server, conns := range p.servers {
+		for _, pc := range conns {
+			pc.conn.Close()
+		}
+		delete(p.servers, server)
+	}
+	return nil
+}
+
+// register picks a socket for server, dialing new ones until the pool is full,
+// and records key as outstanding on it. Sockets are used in rotation; a socket
+// that already has an identical query outstanding is skipped. A socket that
+// reaches its rotation limits is retired from the pool by this call.
+//
+// Sockets are dialed without holding p.mu and under ctx, so resolving a server's
+// host name delays only the queries that need the new socket, within their
+// deadline. A socket dialed after concurrent callers have filled the pool is
+// closed again.
+func (p *UDPPool) register(ctx context.Context, server string, key muxKey) (*pooledConn, chan []byte, error) {
+	size := p.Size
+	if size <= 0 {
+		size = DefaultUDPPoolSize
+	}
+
+	p.mu.Lock()
+	for !p.closed && len(p.servers[server]) < size {
+		p.mu.Unlock()
+		pc, err := p.dial(ctx, server)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to DNS server: %w", contextError(ctx, err))
+		}
+
+		p.mu.Lock()
+		if p.closed || len(p.servers[server]) >= size {
+			pc.conn.Close()
+			continue
+		}
+		if p.servers == nil {
+			p.servers = make(map[string][]*pooledConn)
+		}
+		p.servers[server] = append(p.servers[server], pc)
+	}
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, nil, errPoolClosed
+	}
+
+	conns := p.servers[server]
+	for range conns {
+		pc := conns[p.next%len(conns)]
+		p.next++
+
+		responses, ok := pc.add(key)
+		if !ok {
+			continue
+		}
+		if pc.exhausted(p.maxQueries(), p.maxAge()) {
+			p.retire(pc)
+		}
+		return pc, responses, nil
+	}
+	return nil, nil, fmt.Errorf("query ID %d is already outstanding on every pooled socket", key.id)
+}
+
+// dial opens a new pooled socket to server and starts its reader.
+func (p *UDPPool) dial(ctx context.Context, server string) (*pooledConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	pc := &pooledConn{
+		pool:    p,
+		server:  server,
+		conn:    conn,
+		created: time.Now(),
+		done:    make(chan struct{}),
+		pending: make(map[muxKey]chan []byte),
+	}
+	go pc.read()
+	return pc, nil
+}
+
+// retire removes pc from the pool so it receives no new queries. It is closed
+// once its outstanding queries are answered or abandoned. The caller must hold p.mu.
+func (p *UDPPool) retire(pc *pooledConn) {
+	conns := p.servers[pc.server]
+	for i, c := range conns {
+		if c == pc {
+			p.servers[pc.server] = append(conns[:i:i], conns[i+1:]...)
+			break
+		}
+	}
+
+	pc.mu.Lock()
+	pc.retired = true
+	idle := len(pc.pending) == 0
+	pc.mu.Unlock()
+	if idle {
+		pc.conn.Close()
+	}
+}
+
+// maxQueries returns the rotation limit on queries per socket.
+func (p *UDPPool) maxQueries() int {
+	if p.MaxQueries <= 0 {
+		return DefaultUDPPoolMaxQueries
+	}
+	return p.MaxQueries
+}
+
+// maxAge returns the rotation limit on socket age.
+func (p *UDPPool) maxAge() time.Duration {
+	if p.MaxAge <= 0 {
+		return DefaultUDPPoolMaxAge
+	}
+	return p.MaxAge
+}
+
+// add records key as outstanding and returns the channel its response will be
+// delivered on. It fails if an identical query is already outstanding or the
+// socket has stopped.
+func (pc *pooledConn) add(key muxKey) (chan []byte, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.retired || pc.err != nil {
+		return nil, false
+	}
+	if _, exists := pc.pending[key]; exists {
+		return nil, false
+	}
+	responses := make(chan []byte, 1)
+	pc.pending[key] = responses
+	pc.queries++
+	return responses, true
+}
+
+// unregister forgets an outstanding query, so a late response to it is discarded,
+// and closes a retired socket once nothing is outstanding on it.
+func (pc *pooledConn) unregister(key muxKey) {
+	pc.mu.Lock()
+	delete(pc.pending, key)
+	idle := pc.retired && len(pc.pending) == 0
+	pc.mu.Unlock()
+
+	if idle {
+		pc.conn.Close()
+	}
+}
+
+// exhausted reports whether the socket has reached either rotation limit.
+func (pc *pooledConn) exhausted(maxQueries int, maxAge time.Duration) bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.queries >= maxQueries || time.Since(pc.created) >= maxAge
+}
+
+// read delivers incoming datagrams to the queries waiting for them until the
+// socket is closed or fails. Datagrams that cannot be parsed or that match no
+// outstanding query are dropped.
+func (pc *pooledConn) read() {
+	buf := make([]byte, 65535)
+	for {
+		n, err := pc.conn.Read(buf)
+		if err != nil {
+			pc.stop(err)
+			return
+		}
+
+		pc.mu.Lock()
+		responses, ok := pc.match(buf[:n])
+		pc.mu.Unlock()
+
+		if ok {
+			responses <- append([]byte(nil), buf[:n]...)
+		}
+	}
+}
+
+// match finds the outstanding query that message answers and forgets it. A
+// message without a question is matched by ID if exactly one outstanding query
+// has that ID, since the question cannot tell several apart. The caller must hold
+// pc.mu.
+func (pc *pooledConn) match(message []byte) (chan []byte, bool) {
+	header, err := UnpackHeader(message)
+	if err != nil {
+		return nil, false
+	}
+
+	var key muxKey
+	if header.QDCOUNT == 0 {
+		matches := 0
+		for pending := range pc.pending {
+			if pending.id == header.ID {
+				key = pending
+				matches++
+			}
+		}
+		if matches != 1 {
+			return nil, false
+		}
+	} else if key, err = newMuxKey(message); err != nil {
+		return nil, false
+	}
+
+	responses, ok := pc.pending[key]
+	if ok {
+		delete(pc.pending, key)
+	}
+	return responses, ok
+}
+
+// stop records the error that ended the reader, wakes every waiting query and
+// removes the socket from the pool so that a replacement is dialed.
+func (pc *pooledConn) stop(err error) {
+	pc.mu.Lock()
+	pc.err = err
+	pc.mu.Unlock()
+	close(pc.done)
+
+	pc.pool.mu.Lock()
+	conns := pc.pool.servers[pc.server]
+	for i, c := range conns {
+		if c == pc {
+			pc.pool.servers[pc.server] = append(conns[:i:i], conns[i+1:]...)
+			break
+		}
+	}
+	pc.pool.mu.Unlock()
+	pc.conn.Close()
+}
+
+// newMuxKey extracts the ID and first question of a DNS message.
+func newMuxKey(message []byte) (muxKey, error) {
+	header, err := UnpackHeader(message)
+	if err != nil {
+		return muxKey{}, err
+	}
+	if header.QDCOUNT == 0 {
+		return muxKey{}, fmt.Errorf("message has no question")
+	}
+	question, _, err := parseQuestion(message, 12)
+	if err != nil {
+		return muxKey{}, err
+	}
+	question.Name = strings.ToLower(question.Name)
+	return muxKey{id: header.ID, question: question}, nil
+}
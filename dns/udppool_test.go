@@ -0,0 +1,232 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveUDP starts a UDP server on the loopback interface that answers every
+// query with an A record, and returns its address.
+func serveUDP(t *testing.T) string {
+	return serveUDPFunc(t, func(query []byte, from net.Addr) [][]byte {
+		response, err := answer(query, RcodeSuccess, *aRecord("192.0.2.1", 60))
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		return [][]byte{response}
+	})
+}
+
+// serveUDPFunc starts a UDP server on the loopback interface that sends the
+// datagrams returned by handle in reply to each query, and returns its address.
+// Queries are handled one at a time.
+func serveUDPFunc(t *testing.T, handle func(query []byte, from net.Addr) [][]byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			for _, datagram := range handle(bytes.Clone(buf[:n]), addr) {
+				conn.WriteTo(datagram, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestUDPPoolExchange(t *testing.T) {
+	server := serveUDP(t)
+	pool := NewUDPPool(2)
+	defer pool.Close()
+
+	resolver := NewResolver(server)
+	resolver.UDPPool = pool
+	for range 5 {
+		if _, err := resolver.Resolve("example.com", TypeA); err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+	}
+	if got := len(pool.servers[server]); got != 2 {
+		t.Errorf("pool holds %d sockets, want 2", got)
+	}
+}
+
+func TestUDPPoolDialHonorsContext(t *testing.T) {
+	pool := NewUDPPool(1)
+	defer pool.Close()
+
+	query, _, err := NewResolver("").buildQuery("example.com", TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	_, err = pool.Exchange(ctx, "dns.example.invalid:53", query)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Exchange() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Exchange() took %v after its context was cancelled", elapsed)
+	}
+}
+
+// poolQuery returns a packed query for name A with the given ID.
+func poolQuery(t *testing.T, id uint16, name string) []byte {
+	t.Helper()
+	msg := &DNSMessage{
+		Header:    Header{ID: id, Flags: FlagRD},
+		Questions: []Question{{Name: name, Type: TypeA, Class: 1}},
+	}
+	query, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return query
+}
+
+func TestUDPPoolQuestionlessResponse(t *testing.T) {
+	server := serveUDPFunc(t, func(query []byte, from net.Addr) [][]byte {
+		// A bare header: SERVFAIL without echoing the question.
+		response := make([]byte, 12)
+		copy(response, query[:2])
+		binary.BigEndian.PutUint16(response[2:], FlagQR|uint16(RcodeServerFailure))
+		return [][]byte{response}
+	})
+	pool := NewUDPPool(1)
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	response, err := pool.Exchange(ctx, server, poolQuery(t, 0x1234, "example.com"))
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if id := binary.BigEndian.Uint16(response); id != 0x1234 || len(response) != 12 {
+		t.Errorf("response = %x, want the bare SERVFAIL header for ID 0x1234", response)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Exchange() took %v to deliver the response", elapsed)
+	}
+}
+
+func TestUDPPoolDiscardsUnmatchedDatagrams(t *testing.T) {
+	// Other queries, whose answers must not be taken for the answer to query 2.
+	otherID := poolQuery(t, 99, "example.com")
+	otherQuestion := poolQuery(t, 2, "example.org")
+
+	var abandoned []byte
+	server := serveUDPFunc(t, func(query []byte, from net.Addr) [][]byte {
+		if binary.BigEndian.Uint16(query) == 1 {
+			// Leave the first query unanswered until the second arrives.
+			abandoned = query
+			return nil
+		}
+		late, err := answer(abandoned, RcodeSuccess, *aRecord("192.0.2.99", 60))
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		wrongID, err := answer(otherID, RcodeSuccess, *aRecord("192.0.2.98", 60))
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		wrongQuestion, err := answer(otherQuestion, RcodeSuccess)
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		response, err := answer(query, RcodeSuccess, *aRecord("192.0.2.1", 60))
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		return [][]byte{late, wrongID, wrongQuestion, response}
+	})
+	pool := NewUDPPool(1)
+	defer pool.Close()
+
+	abandonCtx, cancelAbandon := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelAbandon()
+	if _, err := pool.Exchange(abandonCtx, server, poolQuery(t, 1, "example.com")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Exchange() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	response, err := pool.Exchange(ctx, server, poolQuery(t, 2, "example.com"))
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	msg, err := Unpack(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.ID != 2 || len(msg.Answers) != 1 || msg.Answers[0].Data.String() != "192.0.2.1" {
+		t.Errorf("Exchange() returned ID %d with answers %v, want ID 2 answered by 192.0.2.1",
+			msg.Header.ID, formatRecords(msg.Answers))
+	}
+}
+
+func TestUDPPoolRotation(t *testing.T) {
+	tests := []struct {
+		name string
+		pool *UDPPool
+		wait time.Duration // wait is the pause between queries
+	}{
+		{name: "MaxQueries", pool: &UDPPool{Size: 1, MaxQueries: 2, MaxAge: time.Hour}},
+		{name: "MaxAge", pool: &UDPPool{Size: 1, MaxQueries: 1000, MaxAge: 50 * time.Millisecond}, wait: 60 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := make(chan string, 3)
+			server := serveUDPFunc(t, func(query []byte, from net.Addr) [][]byte {
+				sources <- from.String()
+				response, err := answer(query, RcodeSuccess, *aRecord("192.0.2.1", 60))
+				if err != nil {
+					t.Error(err)
+					return nil
+				}
+				return [][]byte{response}
+			})
+			defer tt.pool.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			for i := range 3 {
+				if _, err := tt.pool.Exchange(ctx, server, poolQuery(t, uint16(i), "example.com")); err != nil {
+					t.Fatalf("Exchange() %d error = %v", i, err)
+				}
+				time.Sleep(tt.wait)
+			}
+
+			// The socket that carried the first two queries is retired by the
+			// second, and the third is sent from a fresh one.
+			first, second, third := <-sources, <-sources, <-sources
+			if first != second {
+				t.Errorf("first two queries came from %s and %s, want the same socket", first, second)
+			}
+			if third == second {
+				t.Errorf("third query came from %s, want a rotated socket", third)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Strategy determines how a Resolver distributes queries across its upstream servers.
+type Strategy int
+
+const (
+	// StrategySequential queries the servers in the order they are configured, moving
+	// on to the next server only when the current one fails. The first server
+	// receives all traffic while it is healthy.
+	StrategySequential Strategy = iota
+
+	// StrategyRoundRobin rotates the starting server on every query, spreading load
+	// evenly across all servers while still failing over to the rest of the list.
+	StrategyRoundRobin
+
+	// StrategyRace sends the query to all servers at once and returns the first
+	// valid response, cancelling the outstanding queries. It trades extra upstream
+	// load for the latency of the fastest healthy server.
+	StrategyRace
+)
+
+// String returns the name of the strategy, e.g. "sequential".
+func (s Strategy) String() string {
+	switch s {
+	case StrategySequential:
+		return "sequential"
+	case StrategyRoundRobin:
+		return "round-robin"
+	case StrategyRace:
+		return "race"
+	default:
+		return fmt.Sprintf("Strategy(%d)", int(s))
+	}
+}
+
+// ServerError records why a query to a single upstream server failed.
+type ServerError struct {
+	Server string // Server is the address of the upstream that failed
+	Err    error  // Err is the failure reported for that upstream
+}
+
+// Error returns the server address followed by the failure.
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Server, e.Err)
+}
+
+// Unwrap returns the underlying failure so errors.Is can match sentinel errors
+// such as ErrServerFailed or context.DeadlineExceeded.
+func (e *ServerError) Unwrap() error {
+	return e.Err
+}
+
+// UpstreamError is returned when every attempt against every configured upstream
+// server failed. It lists the failure of each attempt in the order they were made,
+// so callers can tell an unreachable server from one that answered SERVFAIL.
+//
+// Example:
+//
+//	var upstreamErr *dns.UpstreamError
+//	if errors.As(err, &upstreamErr) {
+//		for _, failure := range upstreamErr.Errors {
+//			log.Printf("upstream %s failed: %v", failure.Server, failure.Err)
+//		}
+//	}
+type UpstreamError struct {
+	Errors []*ServerError // Errors holds one entry per failed attempt
+}
+
+// Error summarizes all per-server failures in a single line.
+func (e *UpstreamError) Error() string {
+	failures := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		failures[i] = err.Error()
+	}
+	return fmt.Sprintf("all upstream servers failed: %s", strings.Join(failures, "; "))
+}
+
+// Unwrap returns the per-server failures so errors.Is and errors.As examine each of them.
+func (e *UpstreamError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// servers returns the upstreams to query for one lookup, in the order they should
+// be tried. With StrategyRoundRobin the list is rotated so that successive lookups
+// start at successive servers.
+func (r *Resolver) servers() []string {
+	servers := r.Servers
+	if len(servers) == 0 {
+		servers = []string{r.ServerAddr}
+	}
+	if r.Strategy != StrategyRoundRobin || len(servers) == 1 {
+		return servers
+	}
+
+	// The modulo is taken in uint32 so the index stays non-negative on platforms
+	// where int is 32 bits wide, once the counter passes 2^31.
+	start := int((r.next.Add(1) - 1) % uint32(len(servers)))
+	rotated := make([]string, 0, len(servers))
+	rotated = append(rotated, servers[start:]...)
+	rotated = append(rotated, servers[:start]...)
+	return rotated
+}
+
+// exchange sends the query to the configured upstreams until one of them produces
+// an answer. Timeouts, network errors, malformed replies and error responses such
+// as SERVFAIL and REFUSED cause the next server to be tried; NXDOMAIN is an
+// authoritative answer and is returned immediately. The whole exchange is bounded
+// by the resolver's Timeout, and each attempt by AttemptTimeout.
+//
+// With StrategyRace, each pass over the server list queries all servers
+// concurrently instead of one after another.
+//
+// If every attempt fails, the returned *UpstreamError describes each failure.
+func (r *Resolver) exchange(ctx context.Context, query []byte) (*DNSMessage, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	servers := r.servers()
+	attempts := max(r.Attempts, 1)
+
+	var failures []*ServerError
+	for attempt := 0; attempt < attempts; attempt++ {
+		var (
+			msg    *DNSMessage
+			failed []*ServerError
+			err    error
+		)
+		if r.Strategy == StrategyRace {
+			msg, failed, err = r.race(ctx, servers, query)
+		} else {
+			msg, failed, err = r.sequential(ctx, servers, query)
+		}
+		failures = append(failures, failed...)
+		if msg != nil || err != nil {
+			return msg, err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, &UpstreamError{Errors: failures}
+}
+
+// sequential makes one pass over servers, querying them one at a time. It returns
+// the first answer, or a non-nil error if a server gave a definitive negative
+// answer; otherwise it returns the failure of every server it tried.
+func (r *Resolver) sequential(ctx context.Context, servers []string, query []byte) (*DNSMessage, []*ServerError, error) {
+	var failures []*ServerError
+	for _, server := range servers {
+		msg, err := r.queryServer(ctx, server, query)
+		if err == nil {
+			return msg, failures, nil
+		}
+		if isDefinitive(err) {
+			return nil, failures, err
+		}
+
+		failures = append(failures, &ServerError{Server: server, Err: err})
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, failures, nil
+}
+
+// race queries all servers concurrently and returns the first answer or definitive
+// negative answer, cancelling the queries that are still in flight. Responses that
+// fail validation, SERVFAIL and REFUSED are discarded as failures. If no server
+// answers, the failure of every server is returned in the order they arrived.
+func (r *Resolver) race(ctx context.Context, servers []string, query []byte) (*DNSMessage, []*ServerError, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		msg    *DNSMessage
+		server string
+		err    error
+	}
+	results := make(chan result, len(servers))
+	for _, server := range servers {
+		go func() {
+			msg, err := r.queryServer(ctx, server, query)
+			results <- result{msg: msg, server: server, err: err}
+		}()
+	}
+
+	var failures []*ServerError
+	for range servers {
+		res := <-results
+		if res.err == nil {
+			return res.msg, failures, nil
+		}
+		if isDefinitive(res.err) {
+			return nil, failures, res.err
+		}
+		failures = append(failures, &ServerError{Server: res.server, Err: res.err})
+	}
+	return nil, failures, nil
+}
+
+// isDefinitive reports whether err is an authoritative answer from the upstream
+// that asking another server would not change, such as NXDOMAIN.
+func isDefinitive(err error) bool {
+	return errors.Is(err, ErrNameNotFound)
+}
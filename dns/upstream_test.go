@@ -0,0 +1,250 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServersRoundRobinCounterWrap(t *testing.T) {
+	servers := []string{"a:53", "b:53", "c:53"}
+	tests := []struct {
+		counter uint32
+		want    []string
+	}{
+		{counter: 0, want: []string{"a:53", "b:53", "c:53"}},
+		{counter: 4, want: []string{"b:53", "c:53", "a:53"}},
+		{counter: math.MaxInt32 + 1, want: []string{"c:53", "a:53", "b:53"}},
+		{counter: math.MaxUint32, want: []string{"a:53", "b:53", "c:53"}},
+	}
+	for _, tt := range tests {
+		r := &Resolver{Servers: servers, Strategy: StrategyRoundRobin}
+		r.next.Store(tt.counter)
+		if got := r.servers(); !slices.Equal(got, tt.want) {
+			t.Errorf("servers() with counter %d = %v, want %v", tt.counter, got, tt.want)
+		}
+	}
+}
+
+// upstreamHandler answers a query sent to one fake upstream server.
+type upstreamHandler func(ctx context.Context, query []byte) ([]byte, error)
+
+// upstreamResolver returns a resolver whose upstreams are the given servers, each
+// answered by its handler, and a function that lists the servers queried so far.
+func upstreamResolver(servers []string, handlers map[string]upstreamHandler) (*Resolver, func() []string) {
+	var mu sync.Mutex
+	var queried []string
+	resolver := NewResolver("")
+	resolver.Servers = servers
+	resolver.Transport = transportFunc(func(ctx context.Context, server string, query []byte) ([]byte, error) {
+		mu.Lock()
+		queried = append(queried, server)
+		mu.Unlock()
+		return handlers[server](ctx, query)
+	})
+	return resolver, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(queried)
+	}
+}
+
+// respond returns a handler that answers with rcode and, for NOERROR, an A record.
+func respond(rcode Rcode) upstreamHandler {
+	return func(ctx context.Context, query []byte) ([]byte, error) {
+		if rcode != RcodeSuccess {
+			return answer(query, rcode)
+		}
+		return answer(query, rcode, *aRecord("192.0.2.1", 60))
+	}
+}
+
+// hang returns a handler that never answers and waits for its context to end.
+func hang(ctx context.Context, query []byte) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// unreachable is a handler that fails as if the server could not be reached.
+func unreachable(ctx context.Context, query []byte) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestSequentialFailover(t *testing.T) {
+	servers := []string{"a:53", "b:53", "c:53"}
+	tests := []struct {
+		name        string
+		handlers    map[string]upstreamHandler
+		wantServer  string
+		wantQueried []string
+		wantErr     error
+	}{
+		{
+			name:        "first server answers",
+			handlers:    map[string]upstreamHandler{"a:53": respond(RcodeSuccess)},
+			wantServer:  "a:53",
+			wantQueried: []string{"a:53"},
+		},
+		{
+			name:        "failover after a timeout",
+			handlers:    map[string]upstreamHandler{"a:53": hang, "b:53": respond(RcodeSuccess)},
+			wantServer:  "b:53",
+			wantQueried: []string{"a:53", "b:53"},
+		},
+		{
+			name: "retry on SERVFAIL and REFUSED",
+			handlers: map[string]upstreamHandler{
+				"a:53": respond(RcodeServerFailure),
+				"b:53": respond(RcodeRefused),
+				"c:53": respond(RcodeSuccess),
+			},
+			wantServer:  "c:53",
+			wantQueried: []string{"a:53", "b:53", "c:53"},
+		},
+		{
+			name: "NXDOMAIN stops the walk",
+			handlers: map[string]upstreamHandler{
+				"a:53": unreachable,
+				"b:53": respond(RcodeNameError),
+				"c:53": respond(RcodeSuccess),
+			},
+			wantQueried: []string{"a:53", "b:53"},
+			wantErr:     ErrNameNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, queried := upstreamResolver(servers, tt.handlers)
+			resolver.AttemptTimeout = 50 * time.Millisecond
+
+			msg, err := resolver.Resolve("example.com", TypeA)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Resolve() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			} else if msg.Server != tt.wantServer {
+				t.Errorf("answer from %s, want %s", msg.Server, tt.wantServer)
+			}
+			if got := queried(); !slices.Equal(got, tt.wantQueried) {
+				t.Errorf("queried %v, want %v", got, tt.wantQueried)
+			}
+		})
+	}
+}
+
+func TestSequentialAllFail(t *testing.T) {
+	servers := []string{"a:53", "b:53", "c:53"}
+	resolver, queried := upstreamResolver(servers, map[string]upstreamHandler{
+		"a:53": respond(RcodeServerFailure),
+		"b:53": unreachable,
+		"c:53": hang,
+	})
+	resolver.Attempts = 2
+	resolver.AttemptTimeout = 20 * time.Millisecond
+
+	start := time.Now()
+	_, err := resolver.Resolve("example.com", TypeA)
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) {
+		t.Fatalf("Resolve() error = %v, want *UpstreamError", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Resolve() took %v, want each hung attempt cut short by AttemptTimeout", elapsed)
+	}
+
+	want := []string{"a:53", "b:53", "c:53", "a:53", "b:53", "c:53"}
+	if got := queried(); !slices.Equal(got, want) {
+		t.Errorf("queried %v, want %v", got, want)
+	}
+	var failed []string
+	for _, failure := range upstreamErr.Errors {
+		failed = append(failed, failure.Server)
+	}
+	if !slices.Equal(failed, want) {
+		t.Errorf("UpstreamError lists %v, want %v", failed, want)
+	}
+	if !errors.Is(upstreamErr.Errors[2], context.DeadlineExceeded) {
+		t.Errorf("hung server failure = %v, want context.DeadlineExceeded", upstreamErr.Errors[2])
+	}
+
+	// The joined Unwrap lets callers match any server's failure.
+	if !errors.Is(err, ErrServerFailed) {
+		t.Errorf("errors.Is(%v, ErrServerFailed) = false", err)
+	}
+	if errors.Is(err, ErrRefused) {
+		t.Errorf("errors.Is(%v, ErrRefused) = true", err)
+	}
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) || respErr.Rcode != RcodeServerFailure {
+		t.Errorf("errors.As(%v, *ResponseError) did not find the SERVFAIL response", err)
+	}
+}
+
+func TestRace(t *testing.T) {
+	slowDone := make(chan error, 1)
+	resolver, _ := upstreamResolver([]string{"slow:53", "fast:53", "broken:53"}, map[string]upstreamHandler{
+		"slow:53": func(ctx context.Context, query []byte) ([]byte, error) {
+			select {
+			case <-ctx.Done():
+				slowDone <- ctx.Err()
+				return nil, ctx.Err()
+			case <-time.After(5 * time.Second):
+				slowDone <- nil
+				return answer(query, RcodeSuccess, *aRecord("192.0.2.99", 60))
+			}
+		},
+		"fast:53":   respond(RcodeSuccess),
+		"broken:53": respond(RcodeServerFailure),
+	})
+	resolver.Strategy = StrategyRace
+
+	msg, err := resolver.Resolve("example.com", TypeA)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if msg.Server != "fast:53" {
+		t.Errorf("answer from %s, want fast:53", msg.Server)
+	}
+	select {
+	case err := <-slowDone:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("losing query ended with %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("losing query was not cancelled")
+	}
+}
+
+func TestRaceAllFail(t *testing.T) {
+	servers := []string{"a:53", "b:53", "c:53"}
+	resolver, _ := upstreamResolver(servers, map[string]upstreamHandler{
+		"a:53": respond(RcodeServerFailure),
+		"b:53": unreachable,
+		"c:53": respond(RcodeRefused),
+	})
+	resolver.Strategy = StrategyRace
+
+	_, err := resolver.Resolve("example.com", TypeA)
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) {
+		t.Fatalf("Resolve() error = %v, want *UpstreamError", err)
+	}
+	var failed []string
+	for _, failure := range upstreamErr.Errors {
+		failed = append(failed, failure.Server)
+	}
+	// Failures are listed in the order they arrived, which is not deterministic.
+	slices.Sort(failed)
+	if !slices.Equal(failed, servers) {
+		t.Errorf("UpstreamError lists %v, want every server %v", failed, servers)
+	}
+	if !errors.Is(err, ErrServerFailed) || !errors.Is(err, ErrRefused) {
+		t.Errorf("Resolve() error = %v, want it to match ErrServerFailed and ErrRefused", err)
+	}
+}
@@ -0,0 +1,309 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// typeDNAME is the DNAME record type (RFC 6672). Its records are not decoded, but
+// they are recognized when checking that answers belong to the query.
+const typeDNAME RecordType = 39
+
+// ErrInvalidResponse is matched with errors.Is by every error reporting that a
+// response failed validation against its query. The Resolver treats such
+// responses as failures of the server that sent them, since they may be spoofed
+// or misrouted, and moves on to the next upstream.
+var ErrInvalidResponse = errors.New("invalid response")
+
+// IDMismatchError is returned when a response carries a different ID than the
+// query it was received for.
+type IDMismatchError struct {
+	Query    uint16 // Query is the ID of the query
+	Response uint16 // Response is the ID found in the response
+}
+
+// Error describes the mismatching IDs.
+func (e *IDMismatchError) Error() string {
+	return fmt.Sprintf("response ID %d does not match query ID %d", e.Response, e.Query)
+}
+
+// Is reports whether target is ErrInvalidResponse.
+func (e *IDMismatchError) Is(target error) bool {
+	return target == ErrInvalidResponse
+}
+
+// NotResponseError is returned when a message received from a server does not
+// have the QR bit set, so it is a query rather than a response.
+type NotResponseError struct{}
+
+// Error describes the missing QR bit.
+func (e *NotResponseError) Error() string {
+	return "message received from server is not a response (QR bit not set)"
+}
+
+// Is reports whether target is ErrInvalidResponse.
+func (e *NotResponseError) Is(target error) bool {
+	return target == ErrInvalidResponse
+}
+
+// OpcodeMismatchError is returned when a response carries a different opcode than
+// the query, which RFC 1035 section 4.1.1 requires it to copy.
+type OpcodeMismatchError struct {
+	Query    uint8 // Query is the opcode of the query
+	Response uint8 // Response is the opcode found in the response
+}
+
+// Error describes the mismatching opcodes.
+func (e *OpcodeMismatchError) Error() string {
+	return fmt.Sprintf("response opcode %d does not match query opcode %d", e.Response, e.Query)
+}
+
+// Is reports whether target is ErrInvalidResponse.
+func (e *OpcodeMismatchError) Is(target error) bool {
+	return target == ErrInvalidResponse
+}
+
+// QuestionMismatchError is returned when the question section of a response does
+// not echo the question that was asked. Names are compared case-insensitively.
+type QuestionMismatchError struct {
+	Query    Question   // Query is the question that was asked
+	Response []Question // Response holds the questions found in the response
+}
+
+// Error describes the question that was expected and what was received instead.
+func (e *QuestionMismatchError) Error() string {
+	if len(e.Response) != 1 {
+		return fmt.Sprintf("response has %d questions, expected 1 matching %s %s",
+			len(e.Response), e.Query.Name, e.Query.Type)
+	}
+	got := e.Response[0]
+	return fmt.Sprintf("response question %s %s class %d does not match query %s %s class %d",
+		got.Name, got.Type, got.Class, e.Query.Name, e.Query.Type, e.Query.Class)
+}
+
+// Is reports whether target is ErrInvalidResponse.
+func (e *QuestionMismatchError) Is(target error) bool {
+	return target == ErrInvalidResponse
+}
+
+// CaseMismatchError is returned when case randomization is enabled and the
+// response echoes the query's question with the name in a different case. It is
+// either a forgery or the work of a server that normalizes names; the Resolver
+// tells the two apart by asking the server again.
+type CaseMismatchError struct {
+	Query    string // Query is the query name as sent, in randomized case
+	Response string // Response is the name echoed by the response
+}
+
+// Error describes the mismatching names.
+func (e *CaseMismatchError) Error() string {
+	return fmt.Sprintf("response question name %q does not match the case of query name %q", e.Response, e.Query)
+}
+
+// Is reports whether target is ErrInvalidResponse.
+func (e *CaseMismatchError) Is(target error) bool {
+	return target == ErrInvalidResponse
+}
+
+// OutOfBailiwickError is returned when the answer section of a response holds a
+// record that is owned neither by the queried name nor by a name the answer's
+// CNAME chain leads to. Such records do not answer the question and are a
+// hallmark of cache-poisoning attempts.
+type OutOfBailiwickError struct {
+	Query  string         // Query is the queried name
+	Record ResourceRecord // Record is the first offending answer record
+}
+
+// Error names the offending record.
+func (e *OutOfBailiwickError) Error() string {
+	return fmt.Sprintf("answer record %s %s is outside the chain of query %s",
+		e.Record.Name, e.Record.Type, e.Query)
+}
+
+// Is reports whether target is ErrInvalidResponse.
+func (e *OutOfBailiwickError) Is(target error) bool {
+	return target == ErrInvalidResponse
+}
+
+// validateResponse checks a parsed response against the packed query it answers.
+// The response must carry the query's ID and opcode, have the QR bit set, and echo
+// the query's question. Only responses reporting that the server could not or
+// would not process the query may omit the question, as RFC 1035 permits for
+// messages the server could not interpret; see omitsQuestion. Every answer
+// record must belong to the query's name or its CNAME chain. When exactCase is
+// set, the echoed question name must also match the query's byte for byte.
+//
+// A valid response has its authority and additional sections pruned of records
+// unrelated to the answer; see pruneSections.
+func validateResponse(msg *DNSMessage, query []byte, exactCase bool) error {
+	queryHeader, err := UnpackHeader(query)
+	if err != nil {
+		return err
+	}
+	question, _, err := parseQuestion(query, 12)
+	if err != nil {
+		return err
+	}
+
+	if msg.Header.ID != queryHeader.ID {
+		return &IDMismatchError{Query: queryHeader.ID, Response: msg.Header.ID}
+	}
+	if msg.Header.Flags&FlagQR == 0 {
+		return &NotResponseError{}
+	}
+	if got, want := opcode(msg.Header.Flags), opcode(queryHeader.Flags); got != want {
+		return &OpcodeMismatchError{Query: want, Response: got}
+	}
+
+	switch {
+	case len(msg.Questions) == 0 && omitsQuestion(msg.Rcode()):
+	case len(msg.Questions) != 1 || !questionMatches(msg.Questions[0], question):
+		return &QuestionMismatchError{Query: question, Response: msg.Questions}
+	case exactCase && msg.Questions[0].Name != question.Name:
+		return &CaseMismatchError{Query: question.Name, Response: msg.Questions[0].Name}
+	}
+
+	chain := answerChain(msg.Answers, question.Name)
+	if err := checkBailiwick(msg.Answers, chain, question.Name); err != nil {
+		return err
+	}
+	pruneSections(msg, chain)
+	return nil
+}
+
+// omitsQuestion reports whether a response with the given code may leave out the
+// question section. This is limited to codes that are treated as failures of the
+// server and are never cached; an NXDOMAIN, in particular, must echo the question,
+// or a forged 12-byte header would be enough to deny a name's existence.
+func omitsQuestion(rcode Rcode) bool {
+	switch rcode {
+	case RcodeFormatError, RcodeNotImplemented, RcodeServerFailure, RcodeRefused:
+		return true
+	default:
+		return false
+	}
+}
+
+// opcode extracts the four-bit OPCODE field from header flags.
+func opcode(flags uint16) uint8 {
+	return uint8(flags>>11) & 0x0F
+}
+
+// questionMatches reports whether a response question echoes the query question,
+// comparing names case-insensitively.
+func questionMatches(got, want Question) bool {
+	return got.Type == want.Type && got.Class == want.Class && sameName(got.Name, want.Name)
+}
+
+// answerChain returns the canonical forms of name and of every name reached from
+// it through CNAME records in answers.
+func answerChain(answers []ResourceRecord, name string) map[string]bool {
+	chain := map[string]bool{canonicalName(name): true}
+	for grown := true; grown; {
+		grown = false
+		for _, rr := range answers {
+			cname, ok := rr.Data.(*CNAME)
+			if !ok || !chain[canonicalName(rr.Name)] || chain[canonicalName(cname.Target)] {
+				continue
+			}
+			chain[canonicalName(cname.Target)] = true
+			grown = true
+		}
+	}
+	return chain
+}
+
+// checkBailiwick verifies that every answer record is owned by a name in chain,
+// the query's name and the names its CNAME records lead to. DNAME records are
+// accepted when one of those names lies below their owner, since they are what
+// the accompanying CNAME records are synthesized from (RFC 6672).
+func checkBailiwick(answers []ResourceRecord, chain map[string]bool, name string) error {
+	for _, rr := range answers {
+		if chain[canonicalName(rr.Name)] {
+			continue
+		}
+		if rr.Type == typeDNAME && chainBelow(chain, canonicalName(rr.Name)) {
+			continue
+		}
+		return &OutOfBailiwickError{Query: name, Record: rr}
+	}
+	return nil
+}
+
+// pruneSections removes the authority and additional records that have nothing
+// to do with the answer, so that they are neither returned nor cached with it.
+// Authority records must be owned by a name in chain or by an ancestor of one, as
+// the SOA record of a negative answer and the NS records of a referral are.
+// Additional records must be owned by such a name or by a name that a remaining
+// record points to, such as the address of a name server; the OPT pseudo-record
+// is always kept. Servers legitimately add records a stub resolver has no use
+// for, so unrelated records are dropped rather than failing the response.
+func pruneSections(msg *DNSMessage, chain map[string]bool) {
+	related := func(rr ResourceRecord) bool {
+		owner := canonicalName(rr.Name)
+		return chain[owner] || chainBelow(chain, owner)
+	}
+	msg.Authority = slices.DeleteFunc(msg.Authority, func(rr ResourceRecord) bool {
+		return !related(rr)
+	})
+
+	targets := make(map[string]bool)
+	for _, section := range [][]ResourceRecord{msg.Answers, msg.Authority} {
+		for _, rr := range section {
+			if target := targetName(rr.Data); target != "" {
+				targets[canonicalName(target)] = true
+			}
+		}
+	}
+	msg.Additional = slices.DeleteFunc(msg.Additional, func(rr ResourceRecord) bool {
+		return rr.Type != TypeOPT && !related(rr) && !targets[canonicalName(rr.Name)]
+	})
+
+	msg.Header.NSCOUNT = uint16(len(msg.Authority))
+	msg.Header.ARCOUNT = uint16(len(msg.Additional))
+}
+
+// targetName returns the host name that record data points to, for which a
+// server may supply addresses in the additional section, or "" if it has none.
+func targetName(data RData) string {
+	switch data := data.(type) {
+	case *NS:
+		return data.Host
+	case *MX:
+		return data.Exchange
+	case *SRV:
+		return data.Target
+	case *CNAME:
+		return data.Target
+	case *SOA:
+		return data.MName
+	case *SVCB:
+		return data.Target
+	case *HTTPS:
+		return data.Target
+	}
+	return ""
+}
+
+// chainBelow reports whether any name in chain is a proper subdomain of owner.
+func chainBelow(chain map[string]bool, owner string) bool {
+	for name := range chain {
+		if owner == "" && name != "" || strings.HasSuffix(name, "."+owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameName reports whether two domain names are equal, ignoring case and a
+// trailing dot.
+func sameName(a, b string) bool {
+	return canonicalName(a) == canonicalName(b)
+}
+
+// canonicalName lower-cases a domain name and removes its trailing dot.
+func canonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
@@ -0,0 +1,339 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// lowerCaseAnswer answers query like a server that normalizes the case of the
+// question name it echoes.
+func lowerCaseAnswer(query []byte) ([]byte, error) {
+	msg, err := Unpack(query)
+	if err != nil {
+		return nil, err
+	}
+	msg.Questions[0].Name = strings.ToLower(msg.Questions[0].Name)
+	lowered, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	return answer(lowered, RcodeSuccess, *aRecord("192.0.2.1", 60))
+}
+
+func TestCaseRandomizationIgnoresSingleMismatch(t *testing.T) {
+	var calls atomic.Int32
+	resolver := NewResolver("fake")
+	resolver.CaseRandomization = true
+	resolver.Transport = transportFunc(func(ctx context.Context, server string, query []byte) ([]byte, error) {
+		if calls.Add(1) == 1 {
+			// A forged response that guessed the ID but not the case pattern.
+			return lowerCaseAnswer(query)
+		}
+		return answer(query, RcodeSuccess, *aRecord("192.0.2.1", 60))
+	})
+
+	for range 2 {
+		msg, err := resolver.Resolve("example.com", TypeA)
+		if err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+		if id := binary.BigEndian.Uint16(msg.Raw); id != msg.Header.ID {
+			t.Errorf("Raw carries ID %d, header has ID %d", id, msg.Header.ID)
+		}
+	}
+	if resolver.normalizesCase("fake") {
+		t.Error("one mismatching response marked the server as normalizing case")
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("upstream queried %d times, want 3", got)
+	}
+}
+
+func TestCaseRandomizationDetectsNormalizingServer(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var calls atomic.Int32
+	resolver := NewResolver("fake")
+	resolver.CaseRandomization = true
+	resolver.Clock = clock.Now
+	resolver.Transport = transportFunc(func(ctx context.Context, server string, query []byte) ([]byte, error) {
+		calls.Add(1)
+		return lowerCaseAnswer(query)
+	})
+
+	// The mismatch is confirmed by a probe before falling back.
+	if _, err := resolver.Resolve("example.com", TypeA); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("upstream queried %d times, want 3", got)
+	}
+	if !resolver.normalizesCase("fake") {
+		t.Fatal("server that always normalizes case was not detected")
+	}
+
+	if _, err := resolver.Resolve("example.com", TypeA); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if got := calls.Load(); got != 4 {
+		t.Errorf("upstream queried %d times, want 4", got)
+	}
+
+	clock.Advance(caseNormalizingTTL)
+	if resolver.normalizesCase("fake") {
+		t.Error("server is still held to case-insensitive matching after the mark expired")
+	}
+}
+
+func TestValidateResponseMissingQuestion(t *testing.T) {
+	query := testQuery(t, 0x1234)
+	tests := []struct {
+		rcode   Rcode
+		wantErr bool
+	}{
+		{rcode: RcodeSuccess, wantErr: true},
+		{rcode: RcodeNameError, wantErr: true},
+		{rcode: RcodeNXRRSet, wantErr: true},
+		{rcode: RcodeFormatError},
+		{rcode: RcodeNotImplemented},
+		{rcode: RcodeServerFailure},
+		{rcode: RcodeRefused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rcode.String(), func(t *testing.T) {
+			// A bare 12-byte header: the response carries no question at all.
+			msg := &DNSMessage{Header: Header{ID: 0x1234, Flags: FlagQR | FlagRD | uint16(tt.rcode)}}
+			err := validateResponse(msg, query, false)
+			if tt.wantErr && !errors.Is(err, ErrInvalidResponse) {
+				t.Errorf("validateResponse() error = %v, want ErrInvalidResponse", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateResponse() error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+// packedQuery returns a packed query for name A with ID 0x1234.
+func packedQuery(t *testing.T, name string) []byte {
+	t.Helper()
+	msg := &DNSMessage{
+		Header:    Header{ID: 0x1234, Flags: FlagRD},
+		Questions: []Question{{Name: name, Type: TypeA, Class: 1}},
+	}
+	query, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return query
+}
+
+// testRecord returns a record of the given type owned by name.
+func testRecord(name string, recordType RecordType, data RData) ResourceRecord {
+	return ResourceRecord{Name: name, Type: recordType, Class: 1, TTL: 300, Data: data}
+}
+
+// aData returns the data of an A record for the address s.
+func aData(s string) RData {
+	return &A{Addr: netip.MustParseAddr(s)}
+}
+
+func TestValidateResponse(t *testing.T) {
+	encodedTarget, err := EncodeDomainName("www.example.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dname := &Unknown{Data: encodedTarget}
+
+	tests := []struct {
+		name      string
+		query     string              // query is the queried name, example.com if empty
+		modify    func(m *DNSMessage) // modify alters a valid response to the query
+		exactCase bool
+		wantErr   string // wantErr is the type of the expected error, if any
+	}{
+		{name: "valid", modify: func(m *DNSMessage) {}},
+		{name: "ID mismatch", modify: func(m *DNSMessage) { m.Header.ID++ }, wantErr: "*dns.IDMismatchError"},
+		{name: "QR not set", modify: func(m *DNSMessage) { m.Header.Flags &^= FlagQR }, wantErr: "*dns.NotResponseError"},
+		{
+			name:    "opcode mismatch",
+			modify:  func(m *DNSMessage) { m.Header.Flags |= 2 << 11 },
+			wantErr: "*dns.OpcodeMismatchError",
+		},
+		{
+			name:    "other name",
+			modify:  func(m *DNSMessage) { m.Questions[0].Name = "example.org" },
+			wantErr: "*dns.QuestionMismatchError",
+		},
+		{
+			name:    "other type",
+			modify:  func(m *DNSMessage) { m.Questions[0].Type = TypeAAAA },
+			wantErr: "*dns.QuestionMismatchError",
+		},
+		{
+			name:    "other class",
+			modify:  func(m *DNSMessage) { m.Questions[0].Class = 3 },
+			wantErr: "*dns.QuestionMismatchError",
+		},
+		{
+			name:    "two questions",
+			modify:  func(m *DNSMessage) { m.Questions = append(m.Questions, m.Questions[0]) },
+			wantErr: "*dns.QuestionMismatchError",
+		},
+		{name: "name in other case", modify: func(m *DNSMessage) { m.Questions[0].Name = "EXAMPLE.com" }},
+		{
+			name:      "name in other case with exact case",
+			modify:    func(m *DNSMessage) { m.Questions[0].Name = "EXAMPLE.com" },
+			exactCase: true,
+			wantErr:   "*dns.CaseMismatchError",
+		},
+		{
+			name: "record outside the chain",
+			modify: func(m *DNSMessage) {
+				m.Answers = append(m.Answers, testRecord("www.example.org", TypeA, aData("203.0.113.66")))
+			},
+			wantErr: "*dns.OutOfBailiwickError",
+		},
+		{
+			name: "CNAME chain",
+			modify: func(m *DNSMessage) {
+				m.Answers = []ResourceRecord{
+					testRecord("example.com", TypeCNAME, &CNAME{Target: "www.example.net"}),
+					testRecord("www.example.net", TypeCNAME, &CNAME{Target: "edge.example.org"}),
+					testRecord("edge.example.org", TypeA, aData("192.0.2.1")),
+				}
+			},
+		},
+		{
+			name: "record for an unused CNAME target",
+			modify: func(m *DNSMessage) {
+				m.Answers = []ResourceRecord{
+					testRecord("example.com", TypeA, aData("192.0.2.1")),
+					testRecord("other.example.com", TypeCNAME, &CNAME{Target: "www.example.org"}),
+					testRecord("www.example.org", TypeA, aData("203.0.113.66")),
+				}
+			},
+			wantErr: "*dns.OutOfBailiwickError",
+		},
+		{
+			name:  "DNAME above the chain",
+			query: "www.example.com",
+			modify: func(m *DNSMessage) {
+				m.Answers = []ResourceRecord{
+					testRecord("example.com", typeDNAME, dname),
+					testRecord("www.example.com", TypeCNAME, &CNAME{Target: "www.example.net"}),
+					testRecord("www.example.net", TypeA, aData("192.0.2.1")),
+				}
+			},
+		},
+		{
+			name:  "DNAME outside the chain",
+			query: "www.example.com",
+			modify: func(m *DNSMessage) {
+				m.Answers = []ResourceRecord{
+					testRecord("example.org", typeDNAME, dname),
+					testRecord("www.example.com", TypeA, aData("192.0.2.1")),
+				}
+			},
+			wantErr: "*dns.OutOfBailiwickError",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := tt.query
+			if name == "" {
+				name = "example.com"
+			}
+			msg := &DNSMessage{
+				Header:    Header{ID: 0x1234, Flags: FlagQR | FlagRD | FlagRA},
+				Questions: []Question{{Name: name, Type: TypeA, Class: 1}},
+				Answers:   []ResourceRecord{testRecord(name, TypeA, aData("192.0.2.1"))},
+			}
+			tt.modify(msg)
+
+			err := validateResponse(msg, packedQuery(t, name), tt.exactCase)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateResponse() error = %v", err)
+				}
+				return
+			}
+			if got := fmt.Sprintf("%T", err); got != tt.wantErr {
+				t.Errorf("validateResponse() error = %v (%s), want %s", err, got, tt.wantErr)
+			}
+			if !errors.Is(err, ErrInvalidResponse) {
+				t.Errorf("validateResponse() error = %v, want ErrInvalidResponse", err)
+			}
+		})
+	}
+}
+
+func TestValidateResponseOutOfBailiwickRecord(t *testing.T) {
+	msg := &DNSMessage{
+		Header:    Header{ID: 0x1234, Flags: FlagQR | FlagRD},
+		Questions: []Question{{Name: "example.com", Type: TypeA, Class: 1}},
+		Answers: []ResourceRecord{
+			testRecord("example.com", TypeA, aData("192.0.2.1")),
+			testRecord("bank.example.org", TypeA, aData("203.0.113.66")),
+		},
+	}
+	err := validateResponse(msg, packedQuery(t, "example.com"), false)
+	var bailiwickErr *OutOfBailiwickError
+	if !errors.As(err, &bailiwickErr) {
+		t.Fatalf("validateResponse() error = %v, want *OutOfBailiwickError", err)
+	}
+	if bailiwickErr.Query != "example.com" || bailiwickErr.Record.Name != "bank.example.org" {
+		t.Errorf("error names query %q and record %q, want example.com and bank.example.org",
+			bailiwickErr.Query, bailiwickErr.Record.Name)
+	}
+}
+
+func TestValidateResponsePrunesSections(t *testing.T) {
+	msg := &DNSMessage{
+		Header:    Header{ID: 0x1234, Flags: FlagQR | FlagRD, NSCOUNT: 3, ARCOUNT: 5},
+		Questions: []Question{{Name: "www.example.com", Type: TypeA, Class: 1}},
+		Answers: []ResourceRecord{
+			testRecord("www.example.com", TypeCNAME, &CNAME{Target: "edge.example.net"}),
+			testRecord("edge.example.net", TypeA, aData("192.0.2.1")),
+		},
+		Authority: []ResourceRecord{
+			testRecord("example.net", TypeNS, &NS{Host: "ns1.example.net"}),
+			testRecord("bank.example", TypeNS, &NS{Host: "ns.attacker.example"}),
+			testRecord("com", TypeNS, &NS{Host: "a.gtld-servers.net"}),
+		},
+		Additional: []ResourceRecord{
+			testRecord("ns1.example.net", TypeA, aData("192.0.2.53")),
+			testRecord("ns.attacker.example", TypeA, aData("203.0.113.53")),
+			testRecord("edge.example.net", TypeAAAA, &AAAA{Addr: netip.MustParseAddr("2001:db8::1")}),
+			testRecord("bank.example", TypeA, aData("203.0.113.66")),
+			{Name: "", Type: TypeOPT, Data: &OPT{}},
+		},
+	}
+	if err := validateResponse(msg, packedQuery(t, "www.example.com"), false); err != nil {
+		t.Fatalf("validateResponse() error = %v", err)
+	}
+
+	names := func(records []ResourceRecord) []string {
+		var out []string
+		for _, rr := range records {
+			out = append(out, rr.Name+" "+rr.Type.String())
+		}
+		return out
+	}
+	if got, want := names(msg.Authority), []string{"example.net NS", "com NS"}; !slices.Equal(got, want) {
+		t.Errorf("authority = %q, want %q", got, want)
+	}
+	if got, want := names(msg.Additional), []string{"ns1.example.net A", "edge.example.net AAAA", " OPT"}; !slices.Equal(got, want) {
+		t.Errorf("additional = %q, want %q", got, want)
+	}
+	if msg.Header.NSCOUNT != 2 || msg.Header.ARCOUNT != 3 {
+		t.Errorf("NSCOUNT, ARCOUNT = %d, %d, want 2, 3", msg.Header.NSCOUNT, msg.Header.ARCOUNT)
+	}
+}